@@ -0,0 +1,626 @@
+package xpp
+
+import (
+	"encoding"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Unmarshaler is implemented by types that decode themselves from the
+// parser. UnmarshalXPP is called with the parser on the element's StartTag
+// and must leave it on the matching EndTag. Bind and DecodeElement prefer
+// it over reflection; cmd/xppgen generates it from struct tags.
+type Unmarshaler interface {
+	UnmarshalXPP(p *Parser) error
+}
+
+// FieldError reports a value that could not be bound to a struct field.
+// Bind collects one per failing field and keeps going.
+type FieldError struct {
+	// Path is the slash-separated element path from the bound element to
+	// the failing element; attributes are written as "@name".
+	Path string
+	// Field is the Go field path, such as "Item.PubDate".
+	Field  string
+	Offset int64
+	Err    error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("xpp: binding %s (field %s) at offset %d: %v", e.Path, e.Field, e.Offset, e.Err)
+}
+
+func (e *FieldError) Unwrap() error { return e.Err }
+
+// NestFieldErrors prefixes the Path and Field of every *FieldError in err,
+// including those joined with errors.Join, with the path and Go field of
+// the enclosing element, as Bind reports errors inside nested elements.
+// Generated UnmarshalXPP methods call it on their children's errors. It
+// modifies the errors in place and returns err.
+func NestFieldErrors(err error, path, field string) error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			NestFieldErrors(e, path, field)
+		}
+		return err
+	}
+	var fe *FieldError
+	if errors.As(err, &fe) {
+		fe.Path = path + "/" + fe.Path
+		if fe.Field == "" {
+			fe.Field = field
+		} else {
+			fe.Field = join(field, fe.Field)
+		}
+	}
+	return err
+}
+
+// Bind requires the parser to be on a StartTag and decodes the element into
+// v, which must be a non-nil pointer. It is a reflection-based alternative
+// to DecodeElement that reads through the cursor instead of handing the
+// decoder to encoding/xml, so a value that fails to convert costs only its
+// own field.
+//
+// Struct fields follow the encoding/xml tag rules ("name", "ns name",
+// ",attr", ",chardata", ",comment", ",any", ",any,attr", "-", XMLName and
+// embedded structs), with two differences: element and attribute names
+// match case-insensitively, as in Expect, and ",innerxml" and "a>b" paths
+// are not supported. A value implementing Unmarshaler is handed the parser;
+// otherwise encoding.TextUnmarshaler is used for text and attributes.
+//
+// Conversion failures are collected as *FieldError values and returned
+// together (use errors.As to inspect them); the parser stays healthy and is
+// left on the element's matching EndTag. If the parser becomes poisoned
+// while binding, Bind stops and the decoder error is included in the
+// returned error; check Err to tell the two apart.
+func (p *Parser) Bind(v any) error {
+	if p.err != nil {
+		return p.err
+	}
+	if p.event != StartTag {
+		return p.expectErr(StartTag, "*", "*")
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("xpp: Bind requires a non-nil pointer, got %T", v)
+	}
+	if err := checkBindable(rv.Type().Elem()); err != nil {
+		return err
+	}
+
+	b := binder{p: p}
+	fatal := b.value(rv.Elem(), p.name, "")
+	if fatal != nil {
+		b.errs = append(b.errs, fatal)
+	}
+	return errors.Join(b.errs...)
+}
+
+type binder struct {
+	p    *Parser
+	errs []error
+}
+
+func (b *binder) fieldErr(path, field string, err error) {
+	b.errs = append(b.errs, &FieldError{Path: path, Field: field, Offset: b.p.InputOffset(), Err: err})
+}
+
+// value binds the element the parser is on into v. Only an error that
+// leaves the parser unusable is returned; conversion failures are recorded
+// and the parser is advanced to the element's EndTag.
+func (b *binder) value(v reflect.Value, path, field string) error {
+	p := b.p
+	depth, start := p.depth, p.InputOffset()
+
+	if v.CanAddr() {
+		if u, ok := v.Addr().Interface().(Unmarshaler); ok {
+			if err := u.UnmarshalXPP(p); err != nil {
+				if p.err != nil {
+					return p.err
+				}
+				var fe *FieldError
+				if i := strings.LastIndexByte(path, '/'); i >= 0 && errors.As(err, &fe) {
+					// Its field errors are relative to this element.
+					b.errs = append(b.errs, NestFieldErrors(err, path[:i], field))
+				} else {
+					b.fieldErr(path, field, err)
+				}
+			}
+			return p.syncToEnd(depth, start)
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return b.value(v.Elem(), path, field)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			n := v.Len()
+			v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+			before := len(b.errs)
+			err := b.value(v.Index(n), path, field)
+			if len(b.errs) > before && isLeaf(v.Type().Elem()) {
+				// A scalar that failed to convert is dropped rather than
+				// appended as a zero value.
+				v.SetLen(n)
+			}
+			return err
+		}
+	case reflect.Struct:
+		if !isText(v) {
+			return b.structure(v, path, field)
+		}
+	}
+
+	text, err := p.directText()
+	if err != nil {
+		return err
+	}
+	if err := setText(v, text); err != nil {
+		b.fieldErr(path, field, err)
+	}
+	return nil
+}
+
+func (b *binder) structure(v reflect.Value, path, field string) error {
+	p := b.p
+	info := typeInfoFor(v.Type())
+	depth := p.depth
+
+	if info.xmlName != nil {
+		fieldByIndex(v, info.xmlName.index).Set(reflect.ValueOf(xml.Name{Space: p.space, Local: p.name}))
+	}
+
+	for _, attr := range p.attrs {
+		f := info.attr(attr.Name)
+		if f == nil {
+			continue
+		}
+		fv := fieldByIndex(v, f.index)
+		if fv.Type() == attrType {
+			fv.Set(reflect.ValueOf(attr))
+			continue
+		}
+		if fv.Kind() == reflect.Slice && fv.Type().Elem() == attrType {
+			fv.Set(reflect.Append(fv, reflect.ValueOf(attr)))
+			continue
+		}
+		if err := setText(fv, attr.Value); err != nil {
+			b.fieldErr(path+"/@"+attr.Name.Local, join(field, f.goName), err)
+		}
+	}
+
+	var chardata, comments strings.Builder
+	for {
+		t, err := p.NextToken()
+		if err != nil {
+			return err
+		}
+		switch t {
+		case EndDocument:
+			return unexpectedEOF("binding element")
+		case EndTag:
+			if p.depth != depth {
+				continue
+			}
+			if f := info.chardata; f != nil {
+				if err := setText(fieldByIndex(v, f.index), chardata.String()); err != nil {
+					b.fieldErr(path, join(field, f.goName), err)
+				}
+			}
+			if f := info.comment; f != nil {
+				if err := setText(fieldByIndex(v, f.index), comments.String()); err != nil {
+					b.fieldErr(path, join(field, f.goName), err)
+				}
+			}
+			return nil
+		case Text, CDSect, EntityRef:
+			if info.chardata != nil {
+				chardata.WriteString(p.textValue())
+			}
+		case Comment:
+			if info.comment != nil {
+				comments.WriteString(p.text)
+			}
+		case StartTag:
+			f := info.element(xml.Name{Space: p.space, Local: p.name})
+			if f == nil {
+				if err := p.Skip(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := b.value(fieldByIndex(v, f.index), path+"/"+p.name, join(field, f.goName)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func join(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+// directText consumes the current element through its EndTag and returns
+// its direct character data. Child elements are skipped, matching
+// encoding/xml's treatment of string fields.
+func (p *Parser) directText() (string, error) {
+	depth := p.depth
+	var sb strings.Builder
+	for {
+		t, err := p.NextToken()
+		if err != nil {
+			return "", err
+		}
+		switch t {
+		case Text, CDSect, EntityRef:
+			sb.WriteString(p.textValue())
+		case StartTag:
+			if err := p.Skip(); err != nil {
+				return "", err
+			}
+		case EndTag:
+			if p.depth == depth {
+				return sb.String(), nil
+			}
+		case EndDocument:
+			return "", unexpectedEOF("binding element")
+		}
+	}
+}
+
+// syncToEnd advances to the EndTag at depth, recovering after a handler
+// that stopped early. start is the input offset when the handler was
+// called, which tells an untouched StartTag apart from a sibling's.
+func (p *Parser) syncToEnd(depth int, start int64) error {
+	for {
+		switch {
+		case p.event == EndTag && p.depth == depth:
+			return nil
+		case p.event == StartTag && p.depth == depth && p.InputOffset() == start:
+			return p.Skip()
+		case p.depth < depth || (p.event == StartTag && p.depth == depth):
+			// The handler consumed past the element; there is nothing to
+			// recover to.
+			return p.expectErr(EndTag, "*", "*")
+		}
+		t, err := p.NextToken()
+		if err != nil {
+			return err
+		}
+		if t == EndDocument {
+			return unexpectedEOF("binding element")
+		}
+	}
+}
+
+var (
+	attrType            = reflect.TypeOf(xml.Attr{})
+	nameType            = reflect.TypeOf(xml.Name{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	unmarshalerType     = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+)
+
+func isText(v reflect.Value) bool {
+	return v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType)
+}
+
+// isLeaf reports whether t binds from text alone.
+func isLeaf(t reflect.Type) bool {
+	if reflect.PointerTo(t).Implements(unmarshalerType) {
+		return false
+	}
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		return false
+	case reflect.Pointer:
+		return isLeaf(t.Elem())
+	}
+	return true
+}
+
+func setText(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setText(v.Elem(), s)
+	}
+	if v.CanAddr() {
+		if tu, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return tu.UnmarshalText([]byte(s))
+		}
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(s), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(strings.TrimSpace(s), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("cannot bind text to %s", v.Type())
+		}
+		v.SetBytes([]byte(s))
+	default:
+		return fmt.Errorf("cannot bind text to %s", v.Type())
+	}
+	return nil
+}
+
+// fieldByIndex is reflect.Value.FieldByIndex, allocating nil embedded
+// struct pointers on the way.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+type fieldMode int
+
+const (
+	modeElement fieldMode = iota
+	modeAttr
+	modeAnyAttr
+	modeCharData
+	modeComment
+	modeAny
+)
+
+type fieldInfo struct {
+	index       []int
+	goName      string
+	space, name string
+	mode        fieldMode
+}
+
+type typeInfo struct {
+	xmlName  *fieldInfo
+	fields   []fieldInfo
+	chardata *fieldInfo
+	comment  *fieldInfo
+	err      error
+}
+
+func (ti *typeInfo) attr(n xml.Name) *fieldInfo {
+	var anyAttr *fieldInfo
+	for i := range ti.fields {
+		f := &ti.fields[i]
+		switch f.mode {
+		case modeAttr:
+			if f.matches(n) {
+				return f
+			}
+		case modeAnyAttr:
+			if anyAttr == nil {
+				anyAttr = f
+			}
+		}
+	}
+	return anyAttr
+}
+
+func (ti *typeInfo) element(n xml.Name) *fieldInfo {
+	var anyElem *fieldInfo
+	for i := range ti.fields {
+		f := &ti.fields[i]
+		switch f.mode {
+		case modeElement:
+			if f.matches(n) {
+				return f
+			}
+		case modeAny:
+			if anyElem == nil {
+				anyElem = f
+			}
+		}
+	}
+	return anyElem
+}
+
+func (f *fieldInfo) matches(n xml.Name) bool {
+	return strings.EqualFold(f.name, n.Local) && (f.space == "" || strings.EqualFold(f.space, n.Space))
+}
+
+var typeInfoCache sync.Map // reflect.Type -> *typeInfo
+
+func typeInfoFor(t reflect.Type) *typeInfo {
+	if ti, ok := typeInfoCache.Load(t); ok {
+		return ti.(*typeInfo)
+	}
+	ti := &typeInfo{}
+	ti.err = ti.collect(t, nil)
+	actual, _ := typeInfoCache.LoadOrStore(t, ti)
+	return actual.(*typeInfo)
+}
+
+func (ti *typeInfo) collect(t reflect.Type, parent []int) error {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("xml")
+		if tag == "-" {
+			continue
+		}
+		index := append(append([]int(nil), parent...), i)
+
+		if sf.Anonymous && tag == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+				if !sf.IsExported() && ft.Kind() == reflect.Struct {
+					// reflect cannot allocate through an unexported
+					// embedded pointer.
+					return fmt.Errorf("xpp: Bind: cannot set embedded pointer to unexported struct %s", ft)
+				}
+			}
+			if ft.Kind() == reflect.Struct {
+				if err := ti.collect(ft, index); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+
+		f := fieldInfo{index: index, goName: sf.Name}
+		tokens := strings.Split(tag, ",")
+		f.name = tokens[0]
+		if sp := strings.LastIndexByte(f.name, ' '); sp >= 0 {
+			f.space, f.name = f.name[:sp], f.name[sp+1:]
+		}
+		if strings.Contains(f.name, ">") {
+			return fmt.Errorf("xpp: Bind: field %s: tag path %q is not supported", sf.Name, tokens[0])
+		}
+
+		var attr, anyFlag bool
+		for _, opt := range tokens[1:] {
+			switch opt {
+			case "attr":
+				attr = true
+			case "any":
+				anyFlag = true
+			case "chardata":
+				f.mode = modeCharData
+			case "comment":
+				f.mode = modeComment
+			case "omitempty", "":
+			default:
+				return fmt.Errorf("xpp: Bind: field %s: unsupported tag option %q", sf.Name, opt)
+			}
+		}
+		switch {
+		case attr && anyFlag:
+			f.mode = modeAnyAttr
+		case attr:
+			f.mode = modeAttr
+		case anyFlag:
+			f.mode = modeAny
+		}
+
+		if sf.Name == "XMLName" && sf.Type == nameType {
+			ti.xmlName = &f
+			continue
+		}
+		if f.name == "" {
+			f.name = sf.Name
+		}
+		switch f.mode {
+		case modeCharData:
+			if ti.chardata == nil {
+				ti.chardata = &f
+			}
+			continue
+		case modeComment:
+			if ti.comment == nil {
+				ti.comment = &f
+			}
+			continue
+		}
+		ti.fields = append(ti.fields, f)
+	}
+	return nil
+}
+
+// checkBindable validates the struct tags reachable from t before any
+// input is consumed, so a programming error leaves the parser untouched.
+func checkBindable(t reflect.Type) error {
+	seen := map[reflect.Type]bool{}
+	var walk func(t reflect.Type) error
+	walk = func(t reflect.Type) error {
+		for t.Kind() == reflect.Pointer || (t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8) {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct || seen[t] {
+			return nil
+		}
+		seen[t] = true
+		if reflect.PointerTo(t).Implements(unmarshalerType) || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+			return nil
+		}
+		ti := typeInfoFor(t)
+		if ti.err != nil {
+			return ti.err
+		}
+		for _, f := range ti.fields {
+			ft := t.FieldByIndex(f.index).Type
+			if unbindable(ft) {
+				return fmt.Errorf("xpp: Bind: field %s: cannot bind %s", f.goName, ft)
+			}
+			if err := walk(ft); err != nil {
+				return err
+			}
+		}
+		for _, f := range []*fieldInfo{ti.chardata, ti.comment} {
+			if f == nil {
+				continue
+			}
+			if ft := t.FieldByIndex(f.index).Type; unbindable(ft) {
+				return fmt.Errorf("xpp: Bind: field %s: cannot bind %s", f.goName, ft)
+			}
+		}
+		return nil
+	}
+	return walk(t)
+}
+
+// unbindable reports whether values of t can never be bound, such as
+// maps and interfaces.
+func unbindable(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer || (t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8) {
+		t = t.Elem()
+	}
+	if reflect.PointerTo(t).Implements(unmarshalerType) || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Map, reflect.Interface, reflect.Chan, reflect.Func,
+		reflect.Complex64, reflect.Complex128, reflect.UnsafePointer:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,235 @@
+package xpp_test
+
+import (
+	"encoding/xml"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	xpp "github.com/mmcdole/goxpp/v2"
+)
+
+type bindLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type bindMeta struct {
+	Generator string `xml:"generator"`
+}
+
+type bindItem struct {
+	XMLName xml.Name
+	Title   string     `xml:"title"`
+	PubDate *time.Time `xml:"pubDate"`
+	Count   int        `xml:"count"`
+	Links   []bindLink `xml:"link"`
+	Tags    []int      `xml:"tag"`
+	Creator string     `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	ID      string     `xml:"id,attr"`
+	Other   []xml.Attr `xml:",any,attr"`
+	Ignored string     `xml:"-"`
+	bindMeta
+}
+
+func TestBindStruct(t *testing.T) {
+	doc := `<item id="7" extra="x" xmlns:dc="http://purl.org/dc/elements/1.1/">
+		<Title>Hello</Title>
+		<pubDate>2024-01-02T03:04:05Z</pubDate>
+		<count> 3 </count>
+		<link href="a" rel="alternate"/><link href="b"/>
+		<tag>1</tag><tag>2</tag>
+		<dc:creator>me</dc:creator>
+		<generator>gen</generator>
+		<unknown><nested/></unknown>
+		<Ignored>no</Ignored>
+	</item>`
+	p := newParser(doc)
+	advanceTo(t, p, "item")
+
+	var v bindItem
+	if err := p.Bind(&v); err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+	if v.XMLName.Local != "item" || v.Title != "Hello" || v.Count != 3 || v.ID != "7" {
+		t.Fatalf("bound = %+v", v)
+	}
+	if v.PubDate == nil || v.PubDate.Year() != 2024 {
+		t.Fatalf("PubDate = %v", v.PubDate)
+	}
+	if len(v.Links) != 2 || v.Links[0].Href != "a" || v.Links[0].Rel != "alternate" || v.Links[1].Href != "b" {
+		t.Fatalf("Links = %+v", v.Links)
+	}
+	if len(v.Tags) != 2 || v.Tags[1] != 2 {
+		t.Fatalf("Tags = %v", v.Tags)
+	}
+	if v.Creator != "me" || v.Generator != "gen" || v.Ignored != "" {
+		t.Fatalf("Creator %q Generator %q Ignored %q", v.Creator, v.Generator, v.Ignored)
+	}
+	if len(v.Other) != 2 || v.Other[0].Name.Local != "extra" {
+		t.Fatalf("Other = %+v, want the unmatched attributes", v.Other)
+	}
+	if p.Event() != xpp.EndTag || p.Name() != "item" {
+		t.Fatalf("cursor = %v %q, want EndTag item", p.Event(), p.Name())
+	}
+}
+
+func TestBindCollectsFieldErrors(t *testing.T) {
+	doc := `<feed><item><title>ok</title><pubDate>yesterday</pubDate><count>x</count><tag>1</tag><tag>y</tag></item><next/></feed>`
+	p := newParser(doc)
+	advanceTo(t, p, "item")
+
+	var v bindItem
+	err := p.Bind(&v)
+	if err == nil {
+		t.Fatal("Bind should report the bad fields")
+	}
+	var fe *xpp.FieldError
+	if !errors.As(err, &fe) {
+		t.Fatalf("err = %v, want *FieldError", err)
+	}
+	if fe.Field != "PubDate" || fe.Path != "item/pubDate" {
+		t.Fatalf("first FieldError = %+v, want PubDate at item/pubDate", fe)
+	}
+	if n := strings.Count(err.Error(), "xpp: binding"); n != 3 {
+		t.Fatalf("err reports %d field errors, want 3:\n%v", n, err)
+	}
+	var ne *strconv.NumError
+	if !errors.As(err, &ne) {
+		t.Fatalf("err = %v, should unwrap to the conversion error", err)
+	}
+
+	// Good fields are kept and the failed scalar is not appended.
+	if v.Title != "ok" || len(v.Tags) != 1 || v.Tags[0] != 1 {
+		t.Fatalf("bound = %+v", v)
+	}
+	if p.Err() != nil {
+		t.Fatalf("Err() = %v, parser should stay healthy", p.Err())
+	}
+	if p.Event() != xpp.EndTag || p.Name() != "item" {
+		t.Fatalf("cursor = %v %q, want EndTag item", p.Event(), p.Name())
+	}
+	if tok, err := p.NextTag(); err != nil || tok != xpp.StartTag || p.Name() != "next" {
+		t.Fatalf("NextTag = %v %q (%v), want StartTag next", tok, p.Name(), err)
+	}
+}
+
+type upperText string
+
+func (u *upperText) UnmarshalXPP(p *xpp.Parser) error {
+	s, err := p.NextText()
+	*u = upperText(strings.ToUpper(s))
+	return err
+}
+
+type lazyHook struct{}
+
+// UnmarshalXPP returns an error without consuming the element.
+func (lazyHook) UnmarshalXPP(*xpp.Parser) error { return errors.New("not today") }
+
+func TestBindUnmarshalerHook(t *testing.T) {
+	doc := `<root><a>shout</a><b><x/>text</b><c/></root>`
+	p := newParser(doc)
+	advanceTo(t, p, "root")
+
+	var v struct {
+		A upperText `xml:"a"`
+		B lazyHook  `xml:"b"`
+		C string    `xml:"c"`
+	}
+	err := p.Bind(&v)
+	var fe *xpp.FieldError
+	if !errors.As(err, &fe) || fe.Field != "B" {
+		t.Fatalf("err = %v, want a FieldError for B", err)
+	}
+	if v.A != "SHOUT" {
+		t.Fatalf("A = %q, want SHOUT", v.A)
+	}
+	if p.Event() != xpp.EndTag || p.Name() != "root" {
+		t.Fatalf("cursor = %v %q, want EndTag root", p.Event(), p.Name())
+	}
+}
+
+func TestBindChardataAndComment(t *testing.T) {
+	p := newParser(`<root lang="en">a<!--note-->b<child/>c</root>`)
+	advanceTo(t, p, "root")
+
+	var v struct {
+		Lang    string `xml:"lang,attr"`
+		Text    string `xml:",chardata"`
+		Comment string `xml:",comment"`
+	}
+	if err := p.Bind(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Lang != "en" || v.Text != "abc" || v.Comment != "note" {
+		t.Fatalf("bound = %+v", v)
+	}
+}
+
+func TestBindPreconditions(t *testing.T) {
+	p := newParser(`<root><a/></root>`)
+	var v struct{}
+	var ee *xpp.ExpectError
+	if err := p.Bind(&v); !errors.As(err, &ee) {
+		t.Fatalf("Bind before StartTag: err = %v, want *ExpectError", err)
+	}
+
+	advanceTo(t, p, "root")
+	if err := p.Bind(v); err == nil {
+		t.Fatal("Bind into a non-pointer should fail")
+	}
+	var bad struct {
+		A string `xml:"a>b"`
+	}
+	if err := p.Bind(&bad); err == nil {
+		t.Fatal("Bind with an unsupported tag should fail")
+	}
+	var embedded struct {
+		*bindMeta
+		B string `xml:"b"`
+	}
+	if err := p.Bind(&embedded); err == nil {
+		t.Fatal("Bind through an embedded pointer to an unexported struct should fail")
+	}
+	var mapped struct {
+		A map[string]string `xml:"a"`
+	}
+	if err := p.Bind(&mapped); err == nil {
+		t.Fatal("Bind into a map field should fail")
+	}
+	var iface struct {
+		A []any `xml:",any"`
+	}
+	if err := p.Bind(&iface); err == nil {
+		t.Fatal("Bind into an interface field should fail")
+	}
+	// Neither failure consumed input.
+	if p.Event() != xpp.StartTag || p.Name() != "root" {
+		t.Fatalf("cursor = %v %q, want StartTag root", p.Event(), p.Name())
+	}
+}
+
+func TestDecodeElementPrefersUnmarshaler(t *testing.T) {
+	p := newParser(`<root><a>shout</a><b/></root>`)
+	advanceTo(t, p, "a")
+
+	var u upperText
+	if err := p.DecodeElement(&u); err != nil {
+		t.Fatal(err)
+	}
+	if u != "SHOUT" {
+		t.Fatalf("value = %q, want SHOUT from UnmarshalXPP", u)
+	}
+
+	advanceTo(t, p, "b")
+	var h lazyHook
+	if err := p.DecodeElement(&h); err == nil {
+		t.Fatal("DecodeElement should return the hook's error")
+	}
+	if p.Err() != nil {
+		t.Fatalf("Err() = %v, a hook error must not poison the parser", p.Err())
+	}
+}
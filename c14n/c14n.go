@@ -0,0 +1,430 @@
+// Package c14n writes the canonical form of XML read through an
+// xpp.Parser, as Canonical XML 1.1 or Exclusive XML Canonicalization 1.0,
+// with or without comments. The output is byte-for-byte stable across
+// equivalent serializations, for hashing and signatures.
+//
+// Canonicalization streams: it reads the document or subtree token by
+// token and keeps only the namespace declarations rendered on each open
+// element. Which declarations to render is decided from the parser's
+// namespace scope (Namespaces).
+//
+// Element and attribute names keep their prefixes as written, and
+// attribute values are normalized as XML requires, both of which take the
+// raw input: use a parser from xpp.NewReader, or a Replay of a tape
+// recorded from one. With a parser from xpp.New, prefixes are recovered
+// from the namespace scope, and a name whose namespace is bound to more
+// than one prefix is an error; attribute values are written as decoded,
+// so a literal tab or newline in one is written as a character reference.
+//
+// Attribute defaults are rendered only from a parser built
+// WithDTDDefaults. Entity references must be expanded by the decoder or
+// resolved (WithEntityResolver); an unresolved or empty EntityRef is an
+// error.
+package c14n
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	xpp "github.com/mmcdole/goxpp/v2"
+)
+
+// Method selects the canonicalization algorithm.
+type Method int
+
+const (
+	// Inclusive is Canonical XML 1.1: every namespace in scope is
+	// rendered on a subtree's apex, along with the xml:lang and xml:space
+	// its ancestors set, and an xml:base in scope there is fixed up to the
+	// parser's resolved base URL.
+	Inclusive Method = iota
+	// Exclusive is Exclusive XML Canonicalization 1.0: a namespace is
+	// rendered only where an element or attribute name uses it, or where
+	// Options.InclusivePrefixes lists its prefix.
+	Exclusive
+)
+
+// Algorithm identifiers, as they appear in XML-DSig.
+const (
+	InclusiveURI             = "http://www.w3.org/2006/12/xml-c14n11"
+	InclusiveWithCommentsURI = "http://www.w3.org/2006/12/xml-c14n11#WithComments"
+	ExclusiveURI             = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	ExclusiveWithCommentsURI = "http://www.w3.org/2001/10/xml-exc-c14n#WithComments"
+)
+
+// Options configures Canonicalize.
+type Options struct {
+	Method Method
+	// Comments keeps comments, which are dropped by default.
+	Comments bool
+	// InclusivePrefixes is Exclusive's InclusiveNamespaces PrefixList:
+	// prefixes whose declarations are rendered as Inclusive would, with
+	// "#default" for the default namespace. Inclusive ignores it.
+	InclusivePrefixes []string
+	// Omit, if set, is called on each start tag other than a subtree's
+	// apex and reports whether to leave the element, with its subtree,
+	// out of the output, as XML-DSig's enveloped-signature transform
+	// does.
+	Omit func(p *xpp.Parser) bool
+}
+
+const xmlNS = "http://www.w3.org/XML/1998/namespace"
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;",
+		"\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+// Canonicalize writes the canonical form of XML read from p to w. On a
+// StartTag it writes the element's subtree and leaves the parser on its
+// EndTag. At StartDocument it writes the whole document, without its
+// XML declaration and DOCTYPE, and leaves the parser on EndDocument.
+func Canonicalize(w io.Writer, p *xpp.Parser, opts Options) error {
+	c, err := NewCanonicalizer(w, p, opts)
+	if err != nil {
+		return err
+	}
+	for {
+		done, err := c.Feed()
+		if done || err != nil {
+			return err
+		}
+		if _, err := p.NextToken(); err != nil {
+			return err
+		}
+	}
+}
+
+// Canonicalizer writes the canonical form of XML as something else
+// advances the parser, so that several subtrees, or one subtree several
+// ways, are canonicalized in one pass over the input.
+type Canonicalizer struct {
+	w    *bufio.Writer
+	p    *xpp.Parser
+	opts Options
+	incl map[string]bool
+
+	// document is set when canonicalizing the whole document; seenRoot
+	// records that its root element has started.
+	document, seenRoot bool
+	// skip is the depth of the element Omit is leaving out, 0 if none.
+	skip int
+	done bool
+
+	// rendered holds, per open element, the namespace declarations in
+	// effect in the output, prefix -> URI.
+	rendered []map[string]string
+	// names holds the qualified names of the open elements.
+	names []string
+}
+
+// NewCanonicalizer returns a Canonicalizer writing to w the subtree of
+// the StartTag p is on, or the whole document at StartDocument. Call Feed
+// on that event and on each one the parser reaches after it, until Feed
+// reports done.
+func NewCanonicalizer(w io.Writer, p *xpp.Parser, opts Options) (*Canonicalizer, error) {
+	c := &Canonicalizer{w: bufio.NewWriter(w), p: p, opts: opts}
+	switch p.Event() {
+	case xpp.StartTag:
+	case xpp.StartDocument:
+		c.document = true
+	default:
+		return nil, fmt.Errorf("c14n: parser is on %s, want StartTag or StartDocument", p.Event())
+	}
+	if opts.Method == Exclusive {
+		c.incl = map[string]bool{}
+		for _, prefix := range opts.InclusivePrefixes {
+			if prefix == "#default" {
+				prefix = ""
+			}
+			c.incl[prefix] = true
+		}
+	}
+	return c, nil
+}
+
+// Feed writes the event the parser is on. It reports done, with the
+// output flushed, once the subtree's EndTag or the document's EndDocument
+// has been fed.
+func (c *Canonicalizer) Feed() (done bool, err error) {
+	if c.done {
+		return true, nil
+	}
+	p := c.p
+	event := p.Event()
+	if c.skip > 0 {
+		switch {
+		case event == xpp.EndTag && p.Depth() == c.skip:
+			c.skip = 0
+		case event == xpp.EndDocument:
+			return false, errors.New("c14n: document ended inside the subtree")
+		}
+		return false, nil
+	}
+	// Outside the document element, only comments and processing
+	// instructions are written.
+	outside := len(c.names) == 0
+	switch event {
+	case xpp.StartTag:
+		if outside && c.document {
+			c.seenRoot = true
+		}
+		if c.opts.Omit != nil && (!outside || c.document) && c.opts.Omit(p) {
+			c.skip = p.Depth()
+			return false, nil
+		}
+		return false, c.start()
+	case xpp.EndTag:
+		if outside {
+			return false, errors.New("c14n: EndTag outside the subtree")
+		}
+		n := len(c.names) - 1
+		c.w.WriteString("</")
+		c.w.WriteString(c.names[n])
+		c.w.WriteByte('>')
+		c.names, c.rendered = c.names[:n], c.rendered[:n]
+		if n == 0 && !c.document {
+			return c.finish()
+		}
+	case xpp.Text, xpp.CDSect:
+		if !outside {
+			textEscaper.WriteString(c.w, p.Text())
+		}
+	case xpp.EntityRef:
+		if outside {
+			break
+		}
+		if p.Text() == "" {
+			return false, fmt.Errorf("c14n: unresolved entity reference &%s;", p.Name())
+		}
+		textEscaper.WriteString(c.w, p.Text())
+	case xpp.Comment, xpp.ProcessingInstruction:
+		if event == xpp.Comment && !c.opts.Comments || event == xpp.ProcessingInstruction && p.ProcInst().Target == "xml" {
+			break
+		}
+		// Nodes outside the document element are separated from it by
+		// a line feed.
+		if outside && c.seenRoot {
+			c.w.WriteByte('\n')
+		}
+		c.node(event)
+		if outside && !c.seenRoot {
+			c.w.WriteByte('\n')
+		}
+	case xpp.EndDocument:
+		if !c.document {
+			return false, errors.New("c14n: document ended inside the subtree")
+		}
+		return c.finish()
+	}
+	return false, nil
+}
+
+func (c *Canonicalizer) finish() (bool, error) {
+	c.done = true
+	return true, c.w.Flush()
+}
+
+// node writes the current comment or processing instruction.
+func (c *Canonicalizer) node(event xpp.EventType) {
+	if event == xpp.Comment {
+		c.w.WriteString("<!--")
+		c.w.WriteString(c.p.Text())
+		c.w.WriteString("-->")
+		return
+	}
+	pi := c.p.ProcInst()
+	c.w.WriteString("<?")
+	c.w.WriteString(pi.Target)
+	if pi.Inst != "" {
+		c.w.WriteByte(' ')
+		c.w.WriteString(pi.Inst)
+	}
+	c.w.WriteString("?>")
+}
+
+type attr struct {
+	space, local, prefix, value string
+}
+
+// start writes the start tag the parser is on.
+func (c *Canonicalizer) start() error {
+	p := c.p
+	inScope := p.Namespaces()
+	parent := map[string]string{}
+	if n := len(c.rendered); n > 0 {
+		parent = c.rendered[n-1]
+	}
+	rendered := parent
+	var decls []string
+
+	consider := func(prefix string) {
+		uri := inScope[prefix]
+		if prev, ok := parent[prefix]; ok && prev == uri || !ok && uri == "" {
+			return
+		}
+		if prefix != "" && uri == "" {
+			// XML 1.0 cannot undeclare a prefix.
+			return
+		}
+		for _, d := range decls {
+			if d == prefix {
+				return
+			}
+		}
+		if len(decls) == 0 {
+			rendered = make(map[string]string, len(parent)+1)
+			for k, v := range parent {
+				rendered[k] = v
+			}
+		}
+		rendered[prefix] = uri
+		decls = append(decls, prefix)
+	}
+
+	qname := p.QName()
+	if qname == "" {
+		prefix, err := scopePrefix(inScope, p.Space(), true)
+		if err != nil {
+			return fmt.Errorf("c14n: element %s: %w", p.Name(), err)
+		}
+		qname = qualify(prefix, p.Name())
+	}
+	prefix, _, ok := strings.Cut(qname, ":")
+	if !ok {
+		prefix = ""
+	}
+	var attrs []attr
+	for i, a := range p.Attrs() {
+		if a.Name.Space == "xmlns" || a.Name.Space == "" && a.Name.Local == "xmlns" {
+			continue
+		}
+		a := attr{space: a.Name.Space, local: a.Name.Local, value: p.NormalizedAttr(i)}
+		if written := p.AttrQName(i); written != "" {
+			a.prefix, _, _ = strings.Cut(written, ":")
+			if a.prefix == written {
+				a.prefix = ""
+			}
+		} else if a.space == xmlNS {
+			a.prefix = "xml"
+		} else {
+			var err error
+			if a.prefix, err = scopePrefix(inScope, a.space, false); err != nil {
+				return fmt.Errorf("c14n: attribute %s of %s: %w", a.local, p.Name(), err)
+			}
+		}
+		attrs = append(attrs, a)
+	}
+	if len(c.names) == 0 && c.opts.Method == Inclusive && p.Depth() > 1 {
+		// The apex of a subtree carries the xml:lang and xml:space its
+		// ancestors set, and their base URL.
+		if lang, ok := p.Lang(); ok {
+			attrs = setAttr(attrs, attr{space: xmlNS, local: "lang", prefix: "xml", value: lang})
+		}
+		if space, ok := p.XMLSpace(); ok {
+			attrs = setAttr(attrs, attr{space: xmlNS, local: "space", prefix: "xml", value: space})
+		}
+		if base := p.BaseURL(); base != nil {
+			attrs = setAttr(attrs, attr{space: xmlNS, local: "base", prefix: "xml", value: base.String()})
+		}
+	}
+
+	if c.opts.Method == Exclusive {
+		consider(prefix)
+		for _, a := range attrs {
+			if a.prefix != "" && a.prefix != "xml" {
+				consider(a.prefix)
+			}
+		}
+		for prefix := range c.incl {
+			if _, ok := inScope[prefix]; ok {
+				consider(prefix)
+			}
+		}
+	} else {
+		consider("")
+		for prefix := range inScope {
+			if prefix != "" && prefix != "xml" {
+				consider(prefix)
+			}
+		}
+	}
+
+	sort.Strings(decls)
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].space != attrs[j].space {
+			return attrs[i].space < attrs[j].space
+		}
+		return attrs[i].local < attrs[j].local
+	})
+
+	c.w.WriteByte('<')
+	c.w.WriteString(qname)
+	for _, prefix := range decls {
+		c.w.WriteString(" xmlns")
+		if prefix != "" {
+			c.w.WriteByte(':')
+			c.w.WriteString(prefix)
+		}
+		c.w.WriteString(`="`)
+		attrEscaper.WriteString(c.w, rendered[prefix])
+		c.w.WriteByte('"')
+	}
+	for _, a := range attrs {
+		c.w.WriteByte(' ')
+		c.w.WriteString(qualify(a.prefix, a.local))
+		c.w.WriteString(`="`)
+		attrEscaper.WriteString(c.w, a.value)
+		c.w.WriteByte('"')
+	}
+	c.w.WriteByte('>')
+	c.names = append(c.names, qname)
+	c.rendered = append(c.rendered, rendered)
+	return nil
+}
+
+func setAttr(attrs []attr, a attr) []attr {
+	for i := range attrs {
+		if attrs[i].space == a.space && attrs[i].local == a.local {
+			attrs[i] = a
+			return attrs
+		}
+	}
+	return append(attrs, a)
+}
+
+func qualify(prefix, local string) string {
+	if prefix == "" {
+		return local
+	}
+	return prefix + ":" + local
+}
+
+// scopePrefix recovers the prefix of a name in namespace space from the
+// namespaces in scope, for a parser that does not know the name as
+// written. The default namespace serves only elements.
+func scopePrefix(inScope map[string]string, space string, element bool) (string, error) {
+	if space == "" {
+		return "", nil
+	}
+	var found []string
+	for prefix, uri := range inScope {
+		if uri == space && (prefix != "" || element) {
+			found = append(found, prefix)
+		}
+	}
+	switch len(found) {
+	case 0:
+		// encoding/xml leaves an unbound prefix in place of the URI.
+		return space, nil
+	case 1:
+		return found[0], nil
+	}
+	sort.Strings(found)
+	return "", fmt.Errorf("namespace %s is bound to prefixes %q and the name as written is not known; read the input with xpp.NewReader", space, found)
+}
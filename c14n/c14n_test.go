@@ -0,0 +1,394 @@
+package c14n_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	xpp "github.com/mmcdole/goxpp/v2"
+	"github.com/mmcdole/goxpp/v2/c14n"
+)
+
+func canonicalize(t *testing.T, p *xpp.Parser, opts c14n.Options) string {
+	t.Helper()
+	var out bytes.Buffer
+	if err := c14n.Canonicalize(&out, p, opts); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func document(t *testing.T, doc string, opts c14n.Options, popts ...xpp.Option) string {
+	t.Helper()
+	p := xpp.NewReader(strings.NewReader(doc), popts...)
+	got := canonicalize(t, p, opts)
+	if p.Event() != xpp.EndDocument {
+		t.Fatalf("cursor = %s, want EndDocument", p.Event())
+	}
+	return got
+}
+
+// The examples below are from section 3 of Canonical XML 1.1.
+
+func TestPIsCommentsOutsideDocument(t *testing.T) {
+	doc := `<?xml version="1.0"?>
+
+<?xml-stylesheet   href="doc.xsl"
+   type="text/xsl"   ?>
+
+<!DOCTYPE doc SYSTEM "doc.dtd">
+
+<doc>Hello, world!<!-- Comment 1 --></doc>
+
+<?pi-without-data     ?>
+
+<!-- Comment 2 -->
+
+<!-- Comment 3 -->`
+	want := `<?xml-stylesheet href="doc.xsl"
+   type="text/xsl"   ?>
+<doc>Hello, world!</doc>
+<?pi-without-data?>`
+	if got := document(t, doc, c14n.Options{}); got != want {
+		t.Errorf("without comments:\ngot  %q\nwant %q", got, want)
+	}
+
+	want = `<?xml-stylesheet href="doc.xsl"
+   type="text/xsl"   ?>
+<doc>Hello, world!<!-- Comment 1 --></doc>
+<?pi-without-data?>
+<!-- Comment 2 -->
+<!-- Comment 3 -->`
+	if got := document(t, doc, c14n.Options{Comments: true}); got != want {
+		t.Errorf("with comments:\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestWhitespaceInContent(t *testing.T) {
+	doc := `<doc>
+   <clean>   </clean>
+   <dirty>   A   B   </dirty>
+   <mixed>
+      A
+      <clean>   </clean>
+      <dirty>   A   B   </dirty>
+      AB
+      <mixed>   </mixed>
+   </mixed>
+</doc>`
+	if got := document(t, doc, c14n.Options{}); got != doc {
+		t.Errorf("got  %q\nwant %q", got, doc)
+	}
+}
+
+func TestStartAndEndTags(t *testing.T) {
+	doc := `<!DOCTYPE doc [<!ATTLIST e9 attr CDATA "default">]>
+<doc>
+   <e1   />
+   <e2   ></e2>
+   <e3   name = "elem3"   id="elem3"   />
+   <e4   name="elem4"   id="elem4"   ></e4>
+   <e5 a:attr="out" b:attr="sorted" attr2="all" attr="I'm"
+      xmlns:b="http://www.ietf.org"
+      xmlns:a="http://www.w3.org"
+      xmlns="http://example.org"/>
+   <e6 xmlns="" xmlns:a="http://www.w3.org">
+      <e7 xmlns="http://www.ietf.org">
+         <e8 xmlns="" xmlns:a="http://www.w3.org">
+            <e9 xmlns="" xmlns:a="http://www.ietf.org"/>
+         </e8>
+      </e7>
+   </e6>
+</doc>`
+	want := `<doc>
+   <e1></e1>
+   <e2></e2>
+   <e3 id="elem3" name="elem3"></e3>
+   <e4 id="elem4" name="elem4"></e4>
+   <e5 xmlns="http://example.org" xmlns:a="http://www.w3.org" xmlns:b="http://www.ietf.org" attr="I'm" attr2="all" b:attr="sorted" a:attr="out"></e5>
+   <e6 xmlns:a="http://www.w3.org">
+      <e7 xmlns="http://www.ietf.org">
+         <e8 xmlns="">
+            <e9 xmlns:a="http://www.ietf.org" attr="default"></e9>
+         </e8>
+      </e7>
+   </e6>
+</doc>`
+	if got := document(t, doc, c14n.Options{}, xpp.WithDTDDefaults()); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestCharacterModifications(t *testing.T) {
+	doc := `<!DOCTYPE doc [<!ATTLIST normId id ID #IMPLIED>
+<!ATTLIST normNames attr NMTOKENS #IMPLIED>]>
+<doc>
+   <text>First line&#x0d;&#10;Second line</text>
+   <value>&#x32;</value>
+   <compute><![CDATA[value>"0" && value<"10" ?"valid":"error"]]></compute>
+   <compute expr='value>"0" &amp;&amp; value&lt;"10" ?"valid":"error"'>valid</compute>
+   <norm attr=' &apos;   &#x20;&#13;&#xa;&#9;   &apos; '/>
+   <normNames attr='   A   &#x20;&#13;&#xa;&#9;   B   '/>
+   <normId id=' &apos;   &#x20;&#13;&#xa;&#9;   &apos; '/>
+</doc>`
+	want := `<doc>
+   <text>First line&#xD;
+Second line</text>
+   <value>2</value>
+   <compute>value&gt;"0" &amp;&amp; value&lt;"10" ?"valid":"error"</compute>
+   <compute expr="value>&quot;0&quot; &amp;&amp; value&lt;&quot;10&quot; ?&quot;valid&quot;:&quot;error&quot;">valid</compute>
+   <norm attr=" '    &#xD;&#xA;&#x9;   ' "></norm>
+   <normNames attr="A &#xD;&#xA;&#x9; B"></normNames>
+   <normId id="' &#xD;&#xA;&#x9; '"></normId>
+</doc>`
+	if got := document(t, doc, c14n.Options{}); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestEntityReferences(t *testing.T) {
+	doc := `<!DOCTYPE doc [
+<!ATTLIST doc attrExtEnt ENTITY #IMPLIED>
+<!ENTITY ent1 "Hello">
+<!ENTITY ent2 SYSTEM "world.txt">
+<!ENTITY entExt SYSTEM "earth.gif" NDATA gif>
+<!NOTATION gif SYSTEM "viewgif.exe">
+]>
+<doc attrExtEnt="entExt">
+   &ent1;, &ent2;!
+</doc>
+
+<!-- Let world.txt contain "world" (excluding the quotes) -->`
+	want := `<doc attrExtEnt="entExt">
+   Hello, world!
+</doc>`
+	resolve := func(name string) (string, bool) { return "world", name == "ent2" }
+	got := document(t, doc, c14n.Options{}, xpp.WithDTDEntities(0), xpp.WithEntityResolver(resolve))
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+
+	p := xpp.NewReader(strings.NewReader(doc), xpp.WithDTDEntities(0), xpp.WithEntityRefs())
+	if err := c14n.Canonicalize(io.Discard, p, c14n.Options{}); err == nil {
+		t.Error("unresolved entity reference: err = nil")
+	}
+}
+
+func TestUTF8Encoding(t *testing.T) {
+	doc := `<?xml version="1.0" encoding="ISO-8859-1"?>
+<doc>&#169;</doc>`
+	p := xpp.NewReader(strings.NewReader(doc))
+	// The document is ASCII, so Latin-1 reads as is.
+	p.Decoder().CharsetReader = func(_ string, r io.Reader) (io.Reader, error) { return r, nil }
+	if got, want := canonicalize(t, p, c14n.Options{}), "<doc>©</doc>"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSubtree(t *testing.T) {
+	doc := `<a:root xmlns:a="urn:a" xmlns:b="urn:b" xmlns="urn:d" xml:base="http://example.org/dir/">` +
+		`<a:child xml:base="sub/" b:x="1"><inner/></a:child></a:root>`
+
+	p := xpp.NewReader(strings.NewReader(doc))
+	for p.Name() != "child" {
+		if _, err := p.NextTag(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := canonicalize(t, p, c14n.Options{})
+	want := `<a:child xmlns="urn:d" xmlns:a="urn:a" xmlns:b="urn:b" xml:base="http://example.org/dir/sub/" b:x="1"><inner></inner></a:child>`
+	if got != want {
+		t.Errorf("inclusive:\ngot  %s\nwant %s", got, want)
+	}
+	if p.Event() != xpp.EndTag || p.Name() != "child" {
+		t.Errorf("cursor = %s %s, want EndTag child", p.Event(), p.Name())
+	}
+
+	p = xpp.NewReader(strings.NewReader(doc))
+	for p.Name() != "child" {
+		if _, err := p.NextTag(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got = canonicalize(t, p, c14n.Options{Method: c14n.Exclusive})
+	want = `<a:child xmlns:a="urn:a" xmlns:b="urn:b" xml:base="sub/" b:x="1"><inner xmlns="urn:d"></inner></a:child>`
+	if got != want {
+		t.Errorf("exclusive:\ngot  %s\nwant %s", got, want)
+	}
+}
+
+func TestExclusive(t *testing.T) {
+	// The example from section 2.2 of Exclusive XML Canonicalization:
+	// the same n1:elem2 canonicalizes alike in both documents.
+	docs := []string{
+		`<n0:local xmlns:n0="foo:bar" xmlns:n3="ftp://example.org"><n1:elem2 xmlns:n1="http://example.net" xml:lang="en">
+     <n3:stuff xmlns:n3="ftp://example.org"/>
+  </n1:elem2></n0:local>`,
+		`<n2:pdu xmlns:n1="http://example.com" xmlns:n2="http://foo.example" xml:lang="fr" xml:space="retain"><n1:elem2 xmlns:n1="http://example.net" xml:lang="en">
+     <n3:stuff xmlns:n3="ftp://example.org"/>
+  </n1:elem2></n2:pdu>`,
+	}
+	want := `<n1:elem2 xmlns:n1="http://example.net" xml:lang="en">
+     <n3:stuff xmlns:n3="ftp://example.org"></n3:stuff>
+  </n1:elem2>`
+	for _, doc := range docs {
+		p := xpp.NewReader(strings.NewReader(doc))
+		for p.Name() != "elem2" {
+			if _, err := p.NextTag(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := canonicalize(t, p, c14n.Options{Method: c14n.Exclusive}); got != want {
+			t.Errorf("got  %s\nwant %s", got, want)
+		}
+	}
+
+	p := xpp.NewReader(strings.NewReader(docs[0]))
+	for p.Name() != "elem2" {
+		if _, err := p.NextTag(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := canonicalize(t, p, c14n.Options{Method: c14n.Exclusive, InclusivePrefixes: []string{"n0", "#default"}})
+	want = `<n1:elem2 xmlns:n0="foo:bar" xmlns:n1="http://example.net" xml:lang="en">
+     <n3:stuff xmlns:n3="ftp://example.org"></n3:stuff>
+  </n1:elem2>`
+	if got != want {
+		t.Errorf("InclusivePrefixes:\ngot  %s\nwant %s", got, want)
+	}
+}
+
+func TestOmit(t *testing.T) {
+	doc := `<doc><keep>a</keep><drop><keep/></drop><keep>b</keep></doc>`
+	omit := func(p *xpp.Parser) bool { return p.Name() == "drop" }
+	if got, want := document(t, doc, c14n.Options{Omit: omit}), `<doc><keep>a</keep><keep>b</keep></doc>`; got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestPrefixesAsWritten(t *testing.T) {
+	tests := []struct {
+		doc, inclusive, exclusive string
+	}{
+		{
+			`<foo xmlns="urn:u" xmlns:a="urn:u"><bar/></foo>`,
+			`<foo xmlns="urn:u" xmlns:a="urn:u"><bar></bar></foo>`,
+			`<foo xmlns="urn:u"><bar></bar></foo>`,
+		},
+		{
+			`<a:foo xmlns:a="urn:u" xmlns:b="urn:u" b:x="1"><b:bar a:y="2"/></a:foo>`,
+			`<a:foo xmlns:a="urn:u" xmlns:b="urn:u" b:x="1"><b:bar a:y="2"></b:bar></a:foo>`,
+			`<a:foo xmlns:a="urn:u" xmlns:b="urn:u" b:x="1"><b:bar a:y="2"></b:bar></a:foo>`,
+		},
+	}
+	for _, tt := range tests {
+		if got := document(t, tt.doc, c14n.Options{}); got != tt.inclusive {
+			t.Errorf("inclusive:\ngot  %s\nwant %s", got, tt.inclusive)
+		}
+		if got := document(t, tt.doc, c14n.Options{Method: c14n.Exclusive}); got != tt.exclusive {
+			t.Errorf("exclusive:\ngot  %s\nwant %s", got, tt.exclusive)
+		}
+
+		// A replayed tape keeps the names as written.
+		var tape bytes.Buffer
+		p := xpp.NewReader(strings.NewReader(tt.doc))
+		xpp.NewRecorder(p, &tape)
+		if err := c14n.Canonicalize(io.Discard, p, c14n.Options{}); err != nil {
+			t.Fatal(err)
+		}
+		if got := canonicalize(t, xpp.Replay(&tape), c14n.Options{}); got != tt.inclusive {
+			t.Errorf("replayed:\ngot  %s\nwant %s", got, tt.inclusive)
+		}
+
+		// Without the raw input the prefix is ambiguous.
+		p = xpp.New(xml.NewDecoder(strings.NewReader(tt.doc)))
+		if err := c14n.Canonicalize(io.Discard, p, c14n.Options{}); err == nil {
+			t.Errorf("New parser on %s: err = nil, want an ambiguous prefix error", tt.doc)
+		}
+	}
+
+	p := xpp.New(xml.NewDecoder(strings.NewReader(`<a:foo xmlns:a="urn:a" a:x="1"/>`)))
+	if got, want := canonicalize(t, p, c14n.Options{}), `<a:foo xmlns:a="urn:a" a:x="1"></a:foo>`; got != want {
+		t.Errorf("New parser:\ngot  %s\nwant %s", got, want)
+	}
+}
+
+func TestAttributeNormalization(t *testing.T) {
+	doc := "<a x=\"1\t2\r\n3\n4&#9;5&#10;\"/>"
+	if got, want := document(t, doc, c14n.Options{}), `<a x="1 2 3 4&#x9;5&#xA;"></a>`; got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestInheritedXMLAttributes(t *testing.T) {
+	doc := `<r xml:lang="en" xml:space="preserve"><s xml:lang="fr"><c/><d xml:lang="de"/></s></r>`
+	subtree := func(name string, opts c14n.Options) string {
+		p := xpp.NewReader(strings.NewReader(doc))
+		for p.Name() != name {
+			if _, err := p.NextTag(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return canonicalize(t, p, opts)
+	}
+	if got, want := subtree("c", c14n.Options{}), `<c xml:lang="fr" xml:space="preserve"></c>`; got != want {
+		t.Errorf("inclusive:\ngot  %s\nwant %s", got, want)
+	}
+	if got, want := subtree("d", c14n.Options{}), `<d xml:lang="de" xml:space="preserve"></d>`; got != want {
+		t.Errorf("own xml:lang:\ngot  %s\nwant %s", got, want)
+	}
+	if got, want := subtree("c", c14n.Options{Method: c14n.Exclusive}), `<c></c>`; got != want {
+		t.Errorf("exclusive:\ngot  %s\nwant %s", got, want)
+	}
+	if got, want := subtree("s", c14n.Options{}), `<s xml:lang="fr" xml:space="preserve"><c></c><d xml:lang="de"></d></s>`; got != want {
+		t.Errorf("apex only:\ngot  %s\nwant %s", got, want)
+	}
+}
+
+func TestCanonicalizerOnePass(t *testing.T) {
+	doc := `<!-- c --><a:r xmlns:a="urn:a" xmlns:b="urn:b"><b:s x="1"><t/></b:s><!-- in --></a:r>`
+	p := xpp.NewReader(strings.NewReader(doc))
+	var whole, inclusive, exclusive bytes.Buffer
+	start := func(w io.Writer, opts c14n.Options) *c14n.Canonicalizer {
+		c, err := c14n.NewCanonicalizer(w, p, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	active := []*c14n.Canonicalizer{start(&whole, c14n.Options{Comments: true})}
+	for {
+		if p.Event() == xpp.StartTag && p.Name() == "s" {
+			active = append(active, start(&inclusive, c14n.Options{}), start(&exclusive, c14n.Options{Method: c14n.Exclusive}))
+		}
+		for _, c := range active {
+			if _, err := c.Feed(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if p.Event() == xpp.EndDocument {
+			break
+		}
+		if _, err := p.NextToken(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tt := range []struct {
+		name      string
+		got, want string
+	}{
+		{"document", whole.String(), "<!-- c -->\n" + `<a:r xmlns:a="urn:a" xmlns:b="urn:b"><b:s x="1"><t></t></b:s><!-- in --></a:r>`},
+		{"inclusive", inclusive.String(), `<b:s xmlns:a="urn:a" xmlns:b="urn:b" x="1"><t></t></b:s>`},
+		{"exclusive", exclusive.String(), `<b:s xmlns:b="urn:b" x="1"><t></t></b:s>`},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.name, tt.got, tt.want)
+		}
+	}
+
+	if _, err := c14n.NewCanonicalizer(io.Discard, p, c14n.Options{}); err == nil {
+		t.Error("NewCanonicalizer at EndDocument: err = nil")
+	}
+}
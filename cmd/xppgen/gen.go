@@ -0,0 +1,741 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const xppImport = "github.com/mmcdole/goxpp/v2"
+
+type fieldMode int
+
+const (
+	modeElement fieldMode = iota
+	modeAttr
+	modeAnyAttr
+	modeCharData
+	modeAny
+	modeXMLName
+)
+
+type typeKind int
+
+const (
+	kindScalar    typeKind = iota // string, []byte, bool and numbers
+	kindGenerated                 // a type named in -type
+	kindAttr                      // xml.Attr
+	kindOther                     // anything else, bound with Parser.Bind
+)
+
+// goType describes a field's type as written in the source.
+type goType struct {
+	expr  string // element type, such as "int", "Link" or "time.Time"
+	path  string // import path of a qualified expr
+	kind  typeKind
+	ptr   bool   // the element is *expr
+	slice bool   // the field is a slice of elements
+	under string // for a named scalar type, the scalar it is defined as
+}
+
+// scalarName returns the key of t's conversion in scalars.
+func (t goType) scalarName() string {
+	if t.under != "" {
+		return t.under
+	}
+	return t.expr
+}
+
+type field struct {
+	goName      string
+	space, name string
+	mode        fieldMode
+	typ         goType
+}
+
+// scalar describes how to convert text to a scalar type.
+type scalar struct {
+	parse  string // strconv function, or "" for string and []byte
+	args   string // trailing strconv arguments
+	result string // strconv result type
+}
+
+var scalars = map[string]scalar{
+	"string":  {},
+	"[]byte":  {},
+	"bool":    {"ParseBool", "", "bool"},
+	"int":     {"ParseInt", ", 10, 0", "int64"},
+	"int8":    {"ParseInt", ", 10, 8", "int64"},
+	"int16":   {"ParseInt", ", 10, 16", "int64"},
+	"int32":   {"ParseInt", ", 10, 32", "int64"},
+	"int64":   {"ParseInt", ", 10, 64", "int64"},
+	"uint":    {"ParseUint", ", 10, 0", "uint64"},
+	"uint8":   {"ParseUint", ", 10, 8", "uint64"},
+	"uint16":  {"ParseUint", ", 10, 16", "uint64"},
+	"uint32":  {"ParseUint", ", 10, 32", "uint64"},
+	"uint64":  {"ParseUint", ", 10, 64", "uint64"},
+	"float32": {"ParseFloat", ", 32", "float64"},
+	"float64": {"ParseFloat", ", 64", "float64"},
+}
+
+// typeDef is a named type declared with a type name or []byte, such as
+// "type Kind string", and whether it has an UnmarshalText method.
+type typeDef struct {
+	def  string // the defining type's name, qualified as in its package
+	text bool
+}
+
+type generator struct {
+	buf     bytes.Buffer
+	dir     string
+	pkg     string
+	structs map[string]*ast.StructType
+	named   map[string]bool   // types being generated
+	fileImp map[string]string // package identifier -> import path
+	imports map[string]bool   // import paths the output needs
+
+	// defs holds the typeDefs of dir's package under their names and of
+	// imported packages, once loaded, under path + "." + name.
+	defs     map[string]*typeDef
+	loaded   map[string]bool           // import paths whose defs are in defs
+	packages map[string]*build.Package // by import path; nil if not found
+}
+
+// generate returns the formatted source of UnmarshalXPP methods for the
+// named struct types declared in the package in dir.
+func generate(dir string, types []string) ([]byte, error) {
+	g := &generator{
+		dir:      dir,
+		defs:     map[string]*typeDef{},
+		loaded:   map[string]bool{},
+		packages: map[string]*build.Package{},
+		structs:  map[string]*ast.StructType{},
+		named:    map[string]bool{},
+		fileImp:  map[string]string{},
+		imports:  map[string]bool{"errors": true, "strings": true, xppImport: true},
+	}
+	if err := g.load(dir); err != nil {
+		return nil, err
+	}
+	for _, name := range types {
+		g.named[name] = true
+	}
+
+	var body bytes.Buffer
+	for _, name := range types {
+		st, ok := g.structs[name]
+		if !ok {
+			return nil, fmt.Errorf("struct type %s not found in %s", name, dir)
+		}
+		fields, err := g.fields(name, st)
+		if err != nil {
+			return nil, err
+		}
+		g.buf.Reset()
+		g.method(name, fields)
+		body.Write(g.buf.Bytes())
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by xppgen -type %s; DO NOT EDIT.\n\n", strings.Join(types, ","))
+	fmt.Fprintf(&out, "package %s\n\nimport (\n", g.pkg)
+	paths := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if path != xppImport {
+			fmt.Fprintf(&out, "\t%q\n", path)
+		}
+	}
+	fmt.Fprintf(&out, "\n\txpp %q\n)\n", xppImport)
+	out.Write(body.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %v", err)
+	}
+	return src, nil
+}
+
+// load collects the struct types and imports of the non-test files in dir.
+func (g *generator) load(dir string) error {
+	names, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return err
+	}
+	fset := token.NewFileSet()
+	for _, name := range names {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		src, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		f, err := parser.ParseFile(fset, name, src, parser.SkipObjectResolution)
+		if err != nil {
+			return err
+		}
+		g.pkg = f.Name.Name
+		for _, imp := range f.Imports {
+			path, _ := strconv.Unquote(imp.Path.Value)
+			ident := g.packageName(path)
+			if imp.Name != nil {
+				ident = imp.Name.Name
+			}
+			g.fileImp[ident] = path
+		}
+		g.collect(f, "")
+	}
+	if g.pkg == "" {
+		return fmt.Errorf("no Go files in %s", dir)
+	}
+	return nil
+}
+
+// collect records the struct types and typeDefs declared in f, which is
+// in the package with import path path, or in dir's package if path is
+// empty. Struct types are only needed from dir's package.
+func (g *generator) collect(f *ast.File, path string) {
+	key := func(name string) string {
+		if path == "" {
+			return name
+		}
+		return path + "." + name
+	}
+	def := func(name string) *typeDef {
+		d := g.defs[key(name)]
+		if d == nil {
+			d = &typeDef{}
+			g.defs[key(name)] = d
+		}
+		return d
+	}
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			if decl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if ts.Assign.IsValid() || ts.TypeParams != nil {
+					continue
+				}
+				switch t := ts.Type.(type) {
+				case *ast.StructType:
+					if path == "" {
+						g.structs[ts.Name.Name] = t
+					}
+				case *ast.Ident:
+					def(ts.Name.Name).def = t.Name
+				case *ast.ArrayType:
+					if id, ok := t.Elt.(*ast.Ident); ok && t.Len == nil && id.Name == "byte" {
+						def(ts.Name.Name).def = "[]byte"
+					}
+				}
+			}
+		case *ast.FuncDecl:
+			if decl.Recv == nil || decl.Name.Name != "UnmarshalText" {
+				continue
+			}
+			recv := decl.Recv.List[0].Type
+			if star, ok := recv.(*ast.StarExpr); ok {
+				recv = star.X
+			}
+			if id, ok := recv.(*ast.Ident); ok {
+				def(id.Name).text = true
+			}
+		}
+	}
+}
+
+// importPackage locates the package with the given import path, as the go
+// command would from dir, or returns nil if it cannot be found.
+func (g *generator) importPackage(path string) *build.Package {
+	bp, ok := g.packages[path]
+	if !ok {
+		var err error
+		if bp, err = build.Import(path, g.dir, 0); err != nil {
+			bp = nil
+		}
+		g.packages[path] = bp
+	}
+	return bp
+}
+
+// packageName returns the name the package with the given import path
+// declares. If the package cannot be found it guesses from the path,
+// skipping a major version suffix such as /v2.
+func (g *generator) packageName(path string) string {
+	if bp := g.importPackage(path); bp != nil && bp.Name != "" {
+		return bp.Name
+	}
+	elems := strings.Split(path, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && len(name) > 1 && name[0] == 'v' && strings.Trim(name[1:], "0123456789") == "" {
+		name = elems[len(elems)-2]
+	}
+	return name
+}
+
+// namedScalar reports the scalar that the named type name, declared in
+// the package with import path path, converts through: the predeclared
+// type it is ultimately defined as. It reports false for types that are
+// not scalars and for those with an UnmarshalText method, which is used
+// instead, as Bind does.
+func (g *generator) namedScalar(path, name string) (string, bool) {
+	if path != "" && !g.loaded[path] {
+		g.loaded[path] = true
+		g.loadDefs(path)
+	}
+	for i := 0; i < 10; i++ {
+		key := name
+		if path != "" {
+			key = path + "." + name
+		}
+		d := g.defs[key]
+		if d == nil || d.text {
+			return "", false
+		}
+		if _, ok := scalars[d.def]; ok {
+			return d.def, true
+		}
+		name = d.def
+	}
+	return "", false
+}
+
+// loadDefs collects the typeDefs of an imported package.
+func (g *generator) loadDefs(path string) {
+	bp := g.importPackage(path)
+	if bp == nil {
+		return
+	}
+	fset := token.NewFileSet()
+	for _, name := range bp.GoFiles {
+		f, err := parser.ParseFile(fset, filepath.Join(bp.Dir, name), nil, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+		g.collect(f, path)
+	}
+}
+
+func (g *generator) fields(typeName string, st *ast.StructType) ([]field, error) {
+	var out []field
+	for _, f := range st.Fields.List {
+		if len(f.Names) == 0 {
+			return nil, fmt.Errorf("%s: embedded fields are not supported", typeName)
+		}
+		var tag string
+		if f.Tag != nil {
+			raw, _ := strconv.Unquote(f.Tag.Value)
+			tag = reflect.StructTag(raw).Get("xml")
+		}
+		if tag == "-" {
+			continue
+		}
+		typ, err := g.resolve(f.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", typeName, err)
+		}
+		for _, id := range f.Names {
+			if !id.IsExported() {
+				continue
+			}
+			fd, err := parseTag(id.Name, tag, typ)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %v", typeName, id.Name, err)
+			}
+			out = append(out, fd)
+		}
+	}
+	return out, nil
+}
+
+func parseTag(goName, tag string, typ goType) (field, error) {
+	fd := field{goName: goName, typ: typ}
+	tokens := strings.Split(tag, ",")
+	fd.name = tokens[0]
+	if sp := strings.LastIndexByte(fd.name, ' '); sp >= 0 {
+		fd.space, fd.name = fd.name[:sp], fd.name[sp+1:]
+	}
+	if strings.Contains(fd.name, ">") {
+		return fd, fmt.Errorf("tag path %q is not supported", tokens[0])
+	}
+
+	var attr, anyFlag bool
+	for _, opt := range tokens[1:] {
+		switch opt {
+		case "attr":
+			attr = true
+		case "any":
+			anyFlag = true
+		case "chardata":
+			fd.mode = modeCharData
+		case "omitempty", "":
+		default:
+			return fd, fmt.Errorf("tag option %q is not supported", opt)
+		}
+	}
+	switch {
+	case attr && anyFlag:
+		fd.mode = modeAnyAttr
+	case attr:
+		fd.mode = modeAttr
+	case anyFlag:
+		fd.mode = modeAny
+	}
+	if goName == "XMLName" && typ.path == "encoding/xml" && typ.expr == "xml.Name" {
+		fd.mode = modeXMLName
+	}
+	if fd.name == "" {
+		fd.name = goName
+	}
+
+	switch fd.mode {
+	case modeCharData:
+		if typ.kind != kindScalar || (typ.expr != "string" && typ.expr != "[]byte") || typ.ptr || typ.slice {
+			return fd, fmt.Errorf(",chardata requires string or []byte")
+		}
+	case modeAnyAttr:
+		if typ.kind != kindAttr {
+			return fd, fmt.Errorf(",any,attr requires xml.Attr or []xml.Attr")
+		}
+	case modeAttr:
+		if typ.kind == kindGenerated || typ.kind == kindAttr {
+			return fd, fmt.Errorf("%s cannot be bound from an attribute", typ.expr)
+		}
+	case modeElement, modeAny:
+		if typ.kind == kindAttr {
+			return fd, fmt.Errorf("xml.Attr requires ,attr")
+		}
+	}
+	return fd, nil
+}
+
+func (g *generator) resolve(e ast.Expr) (goType, error) {
+	var t goType
+	if at, ok := e.(*ast.ArrayType); ok && at.Len == nil {
+		if id, ok := at.Elt.(*ast.Ident); ok && id.Name == "byte" {
+			return goType{expr: "[]byte", kind: kindScalar}, nil
+		}
+		t.slice = true
+		e = at.Elt
+	}
+	if star, ok := e.(*ast.StarExpr); ok {
+		t.ptr = true
+		e = star.X
+	}
+	switch x := e.(type) {
+	case *ast.Ident:
+		t.expr = x.Name
+		_, isScalar := scalars[x.Name]
+		switch {
+		case isScalar && x.Name != "[]byte":
+			t.kind = kindScalar
+		case g.structs[x.Name] != nil && g.named[x.Name]:
+			t.kind = kindGenerated
+		default:
+			t.kind = kindOther
+			if under, ok := g.namedScalar("", x.Name); ok {
+				t.kind, t.under = kindScalar, under
+			}
+		}
+		return t, nil
+	case *ast.SelectorExpr:
+		pkg, ok := x.X.(*ast.Ident)
+		if !ok {
+			break
+		}
+		t.expr = pkg.Name + "." + x.Sel.Name
+		t.path = g.fileImp[pkg.Name]
+		if t.path == "" {
+			return t, fmt.Errorf("cannot resolve package %s", pkg.Name)
+		}
+		t.kind = kindOther
+		if t.path == "encoding/xml" && x.Sel.Name == "Attr" {
+			t.kind = kindAttr
+		} else if under, ok := g.namedScalar(t.path, x.Sel.Name); ok {
+			t.kind, t.under = kindScalar, under
+		}
+		return t, nil
+	}
+	return t, fmt.Errorf("unsupported field type %T", e)
+}
+
+func (g *generator) printf(format string, args ...any) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// typeExpr returns the element type expression, recording its import.
+func (g *generator) typeExpr(t goType) string {
+	if t.path != "" {
+		g.imports[t.path] = true
+	}
+	return t.expr
+}
+
+func (g *generator) method(typeName string, fields []field) {
+	var attrs, elems []field
+	var chardata, anyElem *field
+	var xmlName bool
+	for i := range fields {
+		f := &fields[i]
+		switch f.mode {
+		case modeAttr, modeAnyAttr:
+			attrs = append(attrs, *f)
+		case modeElement:
+			elems = append(elems, *f)
+		case modeCharData:
+			if chardata == nil {
+				chardata = f
+			}
+		case modeAny:
+			if anyElem == nil {
+				anyElem = f
+			}
+		case modeXMLName:
+			xmlName = true
+		}
+	}
+
+	g.printf("\n// UnmarshalXPP decodes the %s element the parser is on, leaving it on\n", typeName)
+	g.printf("// the element's matching EndTag. Field errors are collected as\n")
+	g.printf("// *xpp.FieldError values, as in Parser.Bind.\n")
+	g.printf("func (v *%s) UnmarshalXPP(p *xpp.Parser) error {\n", typeName)
+	g.printf("if err := p.Expect(xpp.StartTag, \"*\"); err != nil {\nreturn err\n}\n")
+	g.printf("path := p.Name()\nvar errs []error\n")
+	if xmlName {
+		g.imports["encoding/xml"] = true
+		g.printf("v.XMLName = xml.Name{Space: p.Space(), Local: p.Name()}\n")
+	}
+	if len(attrs) > 0 {
+		g.attrLoop(attrs)
+	}
+	if chardata != nil {
+		g.printf("var chardata strings.Builder\n")
+	}
+
+	g.printf("for {\nt, err := p.Next()\nif err != nil {\nreturn errors.Join(append(errs, err)...)\n}\n")
+	g.printf("switch t {\ncase xpp.Text:\n")
+	if chardata != nil {
+		g.printf("chardata.WriteString(p.Text())\n")
+	}
+	g.printf("continue\ncase xpp.EndTag:\n")
+	if chardata != nil {
+		if chardata.typ.expr == "[]byte" {
+			g.printf("v.%s = []byte(chardata.String())\n", chardata.goName)
+		} else {
+			g.printf("v.%s = chardata.String()\n", chardata.goName)
+		}
+	}
+	g.printf("return errors.Join(errs...)\n")
+	g.printf("case xpp.EndDocument:\nreturn errors.Join(append(errs, p.Expect(xpp.EndTag, \"*\"))...)\n}\n\n")
+
+	if len(elems) == 0 && anyElem == nil {
+		g.printf("if err := p.Skip(); err != nil {\nreturn errors.Join(append(errs, err)...)\n}\n}\n}\n")
+		return
+	}
+	g.printf("depth, name := p.Depth(), p.Name()\nvar field string\nvar ferr error\nswitch {\n")
+	for _, f := range elems {
+		if f.space != "" {
+			g.printf("case strings.EqualFold(p.Space(), %q) && strings.EqualFold(name, %q):\n", f.space, f.name)
+		} else {
+			g.printf("case strings.EqualFold(name, %q):\n", f.name)
+		}
+		g.element(f)
+	}
+	g.printf("default:\n")
+	if anyElem != nil {
+		g.element(*anyElem)
+	} else {
+		g.printf("if err := p.Skip(); err != nil {\nreturn errors.Join(append(errs, err)...)\n}\ncontinue\n")
+	}
+	g.printf("}\n")
+
+	g.printf("if ferr != nil {\nif p.Err() != nil {\nreturn errors.Join(append(errs, ferr)...)\n}\n")
+	g.printf("errs = append(errs, &xpp.FieldError{Path: path + \"/\" + name, Field: field, Offset: p.InputOffset(), Err: ferr})\n}\n")
+	g.printf("// Recover to the child's end tag if it was left early.\n")
+	g.printf("for p.Event() != xpp.EndTag || p.Depth() != depth {\n")
+	g.printf("if _, err := p.Next(); err != nil {\nreturn errors.Join(append(errs, err)...)\n}\n}\n")
+	g.printf("}\n}\n")
+}
+
+func (g *generator) attrLoop(attrs []field) {
+	canFail := false
+	for _, f := range attrs {
+		if f.mode == modeAttr && (f.typ.kind != kindScalar || scalars[f.typ.scalarName()].parse != "") {
+			canFail = true
+		}
+	}
+
+	g.printf("for _, attr := range p.Attrs() {\n")
+	if canFail {
+		g.printf("var field string\nvar ferr error\n")
+	}
+	g.printf("switch {\n")
+	var anyAttr *field
+	for i, f := range attrs {
+		if f.mode == modeAnyAttr {
+			if anyAttr == nil {
+				anyAttr = &attrs[i]
+			}
+			continue
+		}
+		if f.space != "" {
+			g.printf("case strings.EqualFold(attr.Name.Space, %q) && strings.EqualFold(attr.Name.Local, %q):\n", f.space, f.name)
+		} else {
+			g.printf("case strings.EqualFold(attr.Name.Local, %q):\n", f.name)
+		}
+		if canFail {
+			g.printf("field = %q\n", f.goName)
+		}
+		dst := "v." + f.goName
+		switch f.typ.kind {
+		case kindScalar:
+			g.scalar(f.typ, "attr.Value", dst)
+		default:
+			g.textUnmarshaler(f.typ, "attr.Value", dst)
+		}
+	}
+	if anyAttr != nil {
+		g.printf("default:\n")
+		if anyAttr.typ.slice {
+			g.printf("v.%s = append(v.%s, attr)\n", anyAttr.goName, anyAttr.goName)
+		} else {
+			g.printf("v.%s = attr\n", anyAttr.goName)
+		}
+	}
+	g.printf("}\n")
+	if canFail {
+		g.printf("if ferr != nil {\n")
+		g.printf("errs = append(errs, &xpp.FieldError{Path: path + \"/@\" + attr.Name.Local, Field: field, Offset: p.InputOffset(), Err: ferr})\n}\n")
+	}
+	g.printf("}\n")
+}
+
+// element emits the body of a switch case binding the child element the
+// parser is on into field f.
+func (g *generator) element(f field) {
+	g.printf("field = %q\n", f.goName)
+	dst := "v." + f.goName
+	switch f.typ.kind {
+	case kindScalar:
+		g.printf("var s string\nif s, ferr = p.NextText(); ferr == nil {\n")
+		g.scalar(f.typ, "s", dst)
+		g.printf("}\n")
+	case kindGenerated:
+		switch {
+		case f.typ.slice && f.typ.ptr:
+			g.printf("e := new(%s)\n", f.typ.expr)
+			g.nested("e.UnmarshalXPP(p)", "")
+			g.printf("%s = append(%s, e)\n", dst, dst)
+		case f.typ.slice:
+			g.printf("var e %s\n", f.typ.expr)
+			g.nested("e.UnmarshalXPP(p)", "")
+			g.printf("%s = append(%s, e)\n", dst, dst)
+		case f.typ.ptr:
+			g.printf("if %s == nil {\n%s = new(%s)\n}\n", dst, dst, f.typ.expr)
+			g.nested(dst+".UnmarshalXPP(p)", "")
+		default:
+			g.nested(dst+".UnmarshalXPP(p)", "")
+		}
+	default:
+		if !f.typ.slice {
+			g.nested("p.Bind(&"+dst+")", "")
+			return
+		}
+		// A slice element that fails to bind is dropped rather than
+		// appended as a zero value, as Bind does for scalars.
+		star := ""
+		if f.typ.ptr {
+			star = "*"
+		}
+		g.printf("var e %s%s\n", star, g.typeExpr(f.typ))
+		g.nested("p.Bind(&e)", fmt.Sprintf("%s = append(%s, e)\n", dst, dst))
+	}
+}
+
+// nested emits a call to a method that leaves the parser on the element's
+// EndTag and reports its own field errors, relative to the child; they are
+// nested under the parent's path and field. onSuccess runs when it returns
+// nil.
+func (g *generator) nested(call, onSuccess string) {
+	g.printf("if err := %s; err != nil {\n", call)
+	g.printf("if p.Err() != nil {\nreturn errors.Join(append(errs, err)...)\n}\n")
+	g.printf("errs = append(errs, xpp.NestFieldErrors(err, path, field))\n")
+	if onSuccess != "" {
+		g.printf("} else {\n%s", onSuccess)
+	}
+	g.printf("}\n")
+}
+
+// scalar emits a conversion of the string expression src into dst.
+func (g *generator) scalar(t goType, src, dst string) {
+	s := scalars[t.scalarName()]
+	val := src
+	if t.scalarName() == "[]byte" {
+		val = "[]byte(" + src + ")"
+	}
+	if s.parse != "" {
+		g.imports["strconv"] = true
+		g.printf("var x %s\n", s.result)
+		g.printf("if x, ferr = strconv.%s(strings.TrimSpace(%s)%s); ferr == nil {\n", s.parse, src, s.args)
+		val = "x"
+	}
+	if s.parse != "" && t.expr != s.result || s.parse == "" && t.under != "" {
+		val = g.typeExpr(t) + "(" + val + ")"
+	}
+	g.assign(t, dst, val)
+	if s.parse != "" {
+		g.printf("}\n")
+	}
+}
+
+// textUnmarshaler emits a call to the UnmarshalText method of dst's type.
+func (g *generator) textUnmarshaler(t goType, src, dst string) {
+	switch {
+	case t.slice:
+		star := ""
+		if t.ptr {
+			star = "*"
+		}
+		g.printf("var e %s%s\n", star, g.typeExpr(t))
+		if t.ptr {
+			g.printf("e = new(%s)\n", g.typeExpr(t))
+		}
+		g.printf("if ferr = e.UnmarshalText([]byte(%s)); ferr == nil {\n%s = append(%s, e)\n}\n", src, dst, dst)
+	case t.ptr:
+		g.printf("if %s == nil {\n%s = new(%s)\n}\n", dst, dst, g.typeExpr(t))
+		g.printf("ferr = %s.UnmarshalText([]byte(%s))\n", dst, src)
+	default:
+		g.printf("ferr = %s.UnmarshalText([]byte(%s))\n", dst, src)
+	}
+}
+
+func (g *generator) assign(t goType, dst, val string) {
+	switch {
+	case t.slice && t.ptr:
+		g.printf("y := %s\n%s = append(%s, &y)\n", val, dst, dst)
+	case t.slice:
+		g.printf("%s = append(%s, %s)\n", dst, dst, val)
+	case t.ptr:
+		g.printf("y := %s\n%s = &y\n", val, dst)
+	default:
+		g.printf("%s = %s\n", dst, val)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+func TestGenerateGolden(t *testing.T) {
+	dir := filepath.Join("internal", "example")
+	got, err := generate(dir, []string{"Channel", "Item", "Link"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join(dir, "channel_xpp.go")
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("generated code differs from %s; run go test -update", golden)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	cases := map[string]string{
+		"missing":  "package p\ntype Other struct{}\n",
+		"path":     "package p\ntype T struct {\n\tA string `xml:\"a>b\"`\n}\n",
+		"option":   "package p\ntype T struct {\n\tA string `xml:\",innerxml\"`\n}\n",
+		"embedded": "package p\ntype E struct{}\ntype T struct {\n\tE\n}\n",
+		"chardata": "package p\ntype T struct {\n\tA int `xml:\",chardata\"`\n}\n",
+	}
+	for name, src := range cases {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "t.go"), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := generate(dir, []string{"T"})
+		if err == nil {
+			t.Errorf("%s: generate succeeded, want an error", name)
+			continue
+		}
+		if !strings.Contains(err.Error(), "T") {
+			t.Errorf("%s: error %q does not name the type", name, err)
+		}
+	}
+}
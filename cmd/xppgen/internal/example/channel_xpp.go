@@ -0,0 +1,290 @@
+// Code generated by xppgen -type Channel,Item,Link; DO NOT EDIT.
+
+package example
+
+import (
+	"encoding/xml"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	xpp "github.com/mmcdole/goxpp/v2"
+)
+
+// UnmarshalXPP decodes the Channel element the parser is on, leaving it on
+// the element's matching EndTag. Field errors are collected as
+// *xpp.FieldError values, as in Parser.Bind.
+func (v *Channel) UnmarshalXPP(p *xpp.Parser) error {
+	if err := p.Expect(xpp.StartTag, "*"); err != nil {
+		return err
+	}
+	path := p.Name()
+	var errs []error
+	v.XMLName = xml.Name{Space: p.Space(), Local: p.Name()}
+	for _, attr := range p.Attrs() {
+		switch {
+		case strings.EqualFold(attr.Name.Local, "version"):
+			v.Version = attr.Value
+		default:
+			v.Extra = append(v.Extra, attr)
+		}
+	}
+	for {
+		t, err := p.Next()
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		switch t {
+		case xpp.Text:
+			continue
+		case xpp.EndTag:
+			return errors.Join(errs...)
+		case xpp.EndDocument:
+			return errors.Join(append(errs, p.Expect(xpp.EndTag, "*"))...)
+		}
+
+		depth, name := p.Depth(), p.Name()
+		var field string
+		var ferr error
+		switch {
+		case strings.EqualFold(name, "title"):
+			field = "Title"
+			var s string
+			if s, ferr = p.NextText(); ferr == nil {
+				v.Title = s
+			}
+		case strings.EqualFold(name, "ttl"):
+			field = "TTL"
+			var s string
+			if s, ferr = p.NextText(); ferr == nil {
+				var x int64
+				if x, ferr = strconv.ParseInt(strings.TrimSpace(s), 10, 0); ferr == nil {
+					y := int(x)
+					v.TTL = &y
+				}
+			}
+		case strings.EqualFold(name, "item"):
+			field = "Items"
+			e := new(Item)
+			if err := e.UnmarshalXPP(p); err != nil {
+				if p.Err() != nil {
+					return errors.Join(append(errs, err)...)
+				}
+				errs = append(errs, xpp.NestFieldErrors(err, path, field))
+			}
+			v.Items = append(v.Items, e)
+		default:
+			if err := p.Skip(); err != nil {
+				return errors.Join(append(errs, err)...)
+			}
+			continue
+		}
+		if ferr != nil {
+			if p.Err() != nil {
+				return errors.Join(append(errs, ferr)...)
+			}
+			errs = append(errs, &xpp.FieldError{Path: path + "/" + name, Field: field, Offset: p.InputOffset(), Err: ferr})
+		}
+		// Recover to the child's end tag if it was left early.
+		for p.Event() != xpp.EndTag || p.Depth() != depth {
+			if _, err := p.Next(); err != nil {
+				return errors.Join(append(errs, err)...)
+			}
+		}
+	}
+}
+
+// UnmarshalXPP decodes the Item element the parser is on, leaving it on
+// the element's matching EndTag. Field errors are collected as
+// *xpp.FieldError values, as in Parser.Bind.
+func (v *Item) UnmarshalXPP(p *xpp.Parser) error {
+	if err := p.Expect(xpp.StartTag, "*"); err != nil {
+		return err
+	}
+	path := p.Name()
+	var errs []error
+	for _, attr := range p.Attrs() {
+		var field string
+		var ferr error
+		switch {
+		case strings.EqualFold(attr.Name.Local, "draft"):
+			field = "Draft"
+			var x bool
+			if x, ferr = strconv.ParseBool(strings.TrimSpace(attr.Value)); ferr == nil {
+				v.Draft = x
+			}
+		}
+		if ferr != nil {
+			errs = append(errs, &xpp.FieldError{Path: path + "/@" + attr.Name.Local, Field: field, Offset: p.InputOffset(), Err: ferr})
+		}
+	}
+	for {
+		t, err := p.Next()
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		switch t {
+		case xpp.Text:
+			continue
+		case xpp.EndTag:
+			return errors.Join(errs...)
+		case xpp.EndDocument:
+			return errors.Join(append(errs, p.Expect(xpp.EndTag, "*"))...)
+		}
+
+		depth, name := p.Depth(), p.Name()
+		var field string
+		var ferr error
+		switch {
+		case strings.EqualFold(name, "title"):
+			field = "Title"
+			var s string
+			if s, ferr = p.NextText(); ferr == nil {
+				v.Title = s
+			}
+		case strings.EqualFold(name, "link"):
+			field = "Link"
+			if err := v.Link.UnmarshalXPP(p); err != nil {
+				if p.Err() != nil {
+					return errors.Join(append(errs, err)...)
+				}
+				errs = append(errs, xpp.NestFieldErrors(err, path, field))
+			}
+		case strings.EqualFold(name, "pubDate"):
+			field = "PubDate"
+			if err := p.Bind(&v.PubDate); err != nil {
+				if p.Err() != nil {
+					return errors.Join(append(errs, err)...)
+				}
+				errs = append(errs, xpp.NestFieldErrors(err, path, field))
+			}
+		case strings.EqualFold(name, "updated"):
+			field = "Updated"
+			var e time.Time
+			if err := p.Bind(&e); err != nil {
+				if p.Err() != nil {
+					return errors.Join(append(errs, err)...)
+				}
+				errs = append(errs, xpp.NestFieldErrors(err, path, field))
+			} else {
+				v.Updated = append(v.Updated, e)
+			}
+		case strings.EqualFold(p.Space(), "http://purl.org/dc/elements/1.1/") && strings.EqualFold(name, "creator"):
+			field = "Creator"
+			var s string
+			if s, ferr = p.NextText(); ferr == nil {
+				v.Creator = s
+			}
+		case strings.EqualFold(name, "rank"):
+			field = "Rank"
+			var s string
+			if s, ferr = p.NextText(); ferr == nil {
+				var x float64
+				if x, ferr = strconv.ParseFloat(strings.TrimSpace(s), 64); ferr == nil {
+					v.Rank = x
+				}
+			}
+		case strings.EqualFold(name, "tag"):
+			field = "Tags"
+			var s string
+			if s, ferr = p.NextText(); ferr == nil {
+				v.Tags = append(v.Tags, s)
+			}
+		case strings.EqualFold(name, "comments"):
+			field = "Comments"
+			var s string
+			if s, ferr = p.NextText(); ferr == nil {
+				var x uint64
+				if x, ferr = strconv.ParseUint(strings.TrimSpace(s), 10, 16); ferr == nil {
+					v.Comments = uint16(x)
+				}
+			}
+		case strings.EqualFold(name, "guid"):
+			field = "Guid"
+			var s string
+			if s, ferr = p.NextText(); ferr == nil {
+				v.Guid = []byte(s)
+			}
+		default:
+			if err := p.Skip(); err != nil {
+				return errors.Join(append(errs, err)...)
+			}
+			continue
+		}
+		if ferr != nil {
+			if p.Err() != nil {
+				return errors.Join(append(errs, ferr)...)
+			}
+			errs = append(errs, &xpp.FieldError{Path: path + "/" + name, Field: field, Offset: p.InputOffset(), Err: ferr})
+		}
+		// Recover to the child's end tag if it was left early.
+		for p.Event() != xpp.EndTag || p.Depth() != depth {
+			if _, err := p.Next(); err != nil {
+				return errors.Join(append(errs, err)...)
+			}
+		}
+	}
+}
+
+// UnmarshalXPP decodes the Link element the parser is on, leaving it on
+// the element's matching EndTag. Field errors are collected as
+// *xpp.FieldError values, as in Parser.Bind.
+func (v *Link) UnmarshalXPP(p *xpp.Parser) error {
+	if err := p.Expect(xpp.StartTag, "*"); err != nil {
+		return err
+	}
+	path := p.Name()
+	var errs []error
+	for _, attr := range p.Attrs() {
+		var field string
+		var ferr error
+		switch {
+		case strings.EqualFold(attr.Name.Local, "href"):
+			field = "Href"
+			v.Href = attr.Value
+		case strings.EqualFold(attr.Name.Local, "rel"):
+			field = "Rel"
+			v.Rel = Rel(attr.Value)
+		case strings.EqualFold(attr.Name.Local, "length"):
+			field = "Length"
+			var x int64
+			if x, ferr = strconv.ParseInt(strings.TrimSpace(attr.Value), 10, 64); ferr == nil {
+				v.Length = x
+			}
+		case strings.EqualFold(attr.Name.Local, "seen"):
+			field = "Seen"
+			ferr = v.Seen.UnmarshalText([]byte(attr.Value))
+		case strings.EqualFold(attr.Name.Local, "space"):
+			field = "Space"
+			var x int64
+			if x, ferr = strconv.ParseInt(strings.TrimSpace(attr.Value), 10, 0); ferr == nil {
+				v.Space = xpp.SpaceMode(x)
+			}
+		}
+		if ferr != nil {
+			errs = append(errs, &xpp.FieldError{Path: path + "/@" + attr.Name.Local, Field: field, Offset: p.InputOffset(), Err: ferr})
+		}
+	}
+	var chardata strings.Builder
+	for {
+		t, err := p.Next()
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		switch t {
+		case xpp.Text:
+			chardata.WriteString(p.Text())
+			continue
+		case xpp.EndTag:
+			v.Text = chardata.String()
+			return errors.Join(errs...)
+		case xpp.EndDocument:
+			return errors.Join(append(errs, p.Expect(xpp.EndTag, "*"))...)
+		}
+
+		if err := p.Skip(); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+	}
+}
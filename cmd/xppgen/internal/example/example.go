@@ -0,0 +1,48 @@
+// Package example holds the types cmd/xppgen's golden test generates
+// decoders for. The generated code is checked in as channel_xpp.go and
+// exercised by the package's own tests.
+package example
+
+import (
+	"encoding/xml"
+	"time"
+
+	"github.com/mmcdole/goxpp/v2"
+)
+
+//go:generate go run github.com/mmcdole/goxpp/v2/cmd/xppgen -type Channel,Item,Link .
+
+type Channel struct {
+	XMLName xml.Name
+	Title   string     `xml:"title"`
+	TTL     *int       `xml:"ttl"`
+	Items   []*Item    `xml:"item"`
+	Version string     `xml:"version,attr"`
+	Extra   []xml.Attr `xml:",any,attr"`
+}
+
+type Item struct {
+	Title    string      `xml:"title"`
+	Link     Link        `xml:"link"`
+	PubDate  time.Time   `xml:"pubDate"`
+	Updated  []time.Time `xml:"updated"`
+	Creator  string      `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Rank     float64     `xml:"rank"`
+	Tags     []string    `xml:"tag"`
+	Comments uint16      `xml:"comments"`
+	Guid     []byte      `xml:"guid"`
+	Draft    bool        `xml:"draft,attr"`
+	Internal string      `xml:"-"`
+	hidden   string
+}
+
+type Link struct {
+	Href   string        `xml:"href,attr"`
+	Rel    Rel           `xml:"rel,attr"`
+	Length int64         `xml:"length,attr"`
+	Seen   time.Time     `xml:"seen,attr"`
+	Space  xpp.SpaceMode `xml:"space,attr"`
+	Text   string        `xml:",chardata"`
+}
+
+type Rel string
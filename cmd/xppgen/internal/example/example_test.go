@@ -0,0 +1,155 @@
+package example
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+
+	xpp "github.com/mmcdole/goxpp/v2"
+)
+
+func newParser(doc string) *xpp.Parser {
+	d := xml.NewDecoder(bytes.NewReader([]byte(doc)))
+	d.Strict = false
+	return xpp.New(d)
+}
+
+const feed = `<rss><channel version="2.0" foo="bar" xmlns:dc="http://purl.org/dc/elements/1.1/">
+	<title>Feed</title>
+	<ttl>60</ttl>
+	<item draft="true">
+		<title>One</title>
+		<link href="http://a/" rel="alternate" length="12" seen="2024-01-01T00:00:00Z" space="3">http://a/</link>
+		<pubDate>2024-01-02T03:04:05Z</pubDate>
+		<updated>2024-01-03T00:00:00Z</updated>
+		<dc:creator>me</dc:creator>
+		<rank>1.5</rank>
+		<tag>a</tag><tag>b</tag>
+		<comments>4</comments>
+		<guid>g1</guid>
+		<Internal>no</Internal>
+	</item>
+	<item><title>Two</title><rank>high</rank><updated>never</updated><extra><x/></extra></item>
+</channel></rss>`
+
+func TestGeneratedDecoder(t *testing.T) {
+	p := newParser(feed)
+	for {
+		tok, err := p.NextTag()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok == xpp.StartTag && p.Name() == "channel" {
+			break
+		}
+	}
+
+	var c Channel
+	err := p.DecodeElement(&c)
+
+	var fe *xpp.FieldError
+	if !errors.As(err, &fe) || fe.Field != "Items.Rank" || fe.Path != "channel/item/rank" {
+		t.Fatalf("err = %v, want a FieldError for channel/item/rank first", err)
+	}
+	if p.Err() != nil {
+		t.Fatalf("Err() = %v, the generated path must not poison the parser", p.Err())
+	}
+	if p.Event() != xpp.EndTag || p.Name() != "channel" {
+		t.Fatalf("cursor = %v %q, want EndTag channel", p.Event(), p.Name())
+	}
+
+	if c.XMLName.Local != "channel" || c.Title != "Feed" || c.Version != "2.0" {
+		t.Fatalf("channel = %+v", c)
+	}
+	if c.TTL == nil || *c.TTL != 60 {
+		t.Fatalf("TTL = %v, want 60", c.TTL)
+	}
+	if len(c.Extra) != 2 || c.Extra[0].Name.Local != "foo" {
+		t.Fatalf("Extra = %+v", c.Extra)
+	}
+	if len(c.Items) != 2 {
+		t.Fatalf("len(Items) = %d, want 2", len(c.Items))
+	}
+
+	one := c.Items[0]
+	if one.Title != "One" || !one.Draft || one.Creator != "me" || one.Rank != 1.5 ||
+		one.Comments != 4 || string(one.Guid) != "g1" || one.Internal != "" {
+		t.Fatalf("item one = %+v", one)
+	}
+	if one.Link.Href != "http://a/" || one.Link.Rel != "alternate" || one.Link.Length != 12 ||
+		one.Link.Space != xpp.SpaceCollapse || one.Link.Text != "http://a/" || one.Link.Seen.Year() != 2024 {
+		t.Fatalf("link = %+v", one.Link)
+	}
+	if one.PubDate.Day() != 2 || len(one.Updated) != 1 || len(one.Tags) != 2 {
+		t.Fatalf("PubDate %v Updated %v Tags %v", one.PubDate, one.Updated, one.Tags)
+	}
+
+	// The second item keeps its good fields; the bad time is dropped.
+	two := c.Items[1]
+	if two.Title != "Two" || two.Rank != 0 || len(two.Updated) != 0 {
+		t.Fatalf("item two = %+v", two)
+	}
+}
+
+func TestGeneratedMatchesBind(t *testing.T) {
+	const doc = `<item draft="maybe"><title>T</title><link href="h" rel="self" length="x" space="1">x</link><tag>a</tag>` +
+		`<pubDate>soon</pubDate><rank>high</rank></item>`
+
+	p := newParser(doc)
+	if _, err := p.NextTag(); err != nil {
+		t.Fatal(err)
+	}
+	var generated Item
+	genErr := generated.UnmarshalXPP(p)
+
+	// Bind would call UnmarshalXPP itself; hide it to compare with the
+	// reflection path.
+	type plain Item
+	p = newParser(doc)
+	if _, err := p.NextTag(); err != nil {
+		t.Fatal(err)
+	}
+	var reflected plain
+	bindErr := p.Bind(&reflected)
+
+	if generated.Title != reflected.Title || generated.Draft != reflected.Draft ||
+		generated.Rank != reflected.Rank || len(generated.Tags) != len(reflected.Tags) ||
+		generated.Link != reflected.Link {
+		t.Fatalf("generated %+v\nreflected %+v", generated, reflected)
+	}
+	gen, bound := fieldErrors(genErr), fieldErrors(bindErr)
+	if len(gen) != 4 || strings.Join(gen, " ") != strings.Join(bound, " ") {
+		t.Fatalf("field errors:\ngenerated %v\nreflected %v", gen, bound)
+	}
+
+	// Nested generated decoders report paths from the bound element too.
+	type plainChannel Channel
+	p = newParser(`<channel><item><rank>high</rank><link length="x"/></item></channel>`)
+	if _, err := p.NextTag(); err != nil {
+		t.Fatal(err)
+	}
+	var c plainChannel
+	got := fieldErrors(p.Bind(&c))
+	want := []string{"channel/item/rank Items.Rank", "channel/item/link/@length Items.Link.Length"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("field errors = %q, want %q", got, want)
+	}
+}
+
+// fieldErrors lists the path and field of each *xpp.FieldError in err.
+func fieldErrors(err error) []string {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var out []string
+		for _, e := range joined.Unwrap() {
+			out = append(out, fieldErrors(e)...)
+		}
+		return out
+	}
+	var fe *xpp.FieldError
+	if errors.As(err, &fe) {
+		return []string{fe.Path + " " + fe.Field}
+	}
+	return nil
+}
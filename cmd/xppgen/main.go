@@ -0,0 +1,60 @@
+// Command xppgen generates UnmarshalXPP methods for Go struct types, so
+// they can be decoded from an xpp.Parser without reflection.
+//
+// Usage:
+//
+//	xppgen -type Item,Channel [-output file] [dir]
+//
+// xppgen reads the package in dir (default ".") and writes the methods for
+// the named types to -output, or to <first type>_xpp.go in dir. It is
+// meant to be run from a go:generate directive:
+//
+//	//go:generate xppgen -type Item,Channel
+//
+// Fields are mapped with the same xml struct tags Bind understands. Fields
+// of the named types call each other's generated methods; fields of named
+// scalar types, such as "type Kind string", are converted through the
+// scalar unless the type has an UnmarshalText method; fields of other
+// non-scalar types, such as time.Time, fall back to Parser.Bind.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	typeNames := flag.String("type", "", "comma-separated list of type names; required")
+	output := flag.String("output", "", "output file name; default <dir>/<type>_xpp.go")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: xppgen -type T[,T...] [-output file] [dir]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *typeNames == "" || flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dir := "."
+	if flag.NArg() == 1 {
+		dir = flag.Arg(0)
+	}
+	types := strings.Split(*typeNames, ",")
+
+	src, err := generate(dir, types)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "xppgen: %v\n", err)
+		os.Exit(1)
+	}
+	out := *output
+	if out == "" {
+		out = filepath.Join(dir, strings.ToLower(types[0])+"_xpp.go")
+	}
+	if err := os.WriteFile(out, src, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "xppgen: %v\n", err)
+		os.Exit(1)
+	}
+}
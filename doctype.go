@@ -0,0 +1,786 @@
+package xpp
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// DocType is the parsed document type declaration. The internal subset is
+// parsed into its markup declarations; the external subset named by
+// SystemID is never fetched. Parameter entity references between
+// declarations are skipped, not expanded.
+type DocType struct {
+	Name               string
+	PublicID, SystemID string
+
+	Elements  []ElementDecl
+	AttLists  []AttListDecl
+	Entities  []EntityDecl
+	Notations []NotationDecl
+
+	// Errors holds the declarations that could not be parsed and, with
+	// WithDTDEntities, the entities that could not be installed. Parsing
+	// continues after each.
+	Errors []error
+}
+
+// ElementDecl is an <!ELEMENT> declaration. Content is the content
+// specification as written, such as "EMPTY" or "(#PCDATA|em)*".
+type ElementDecl struct {
+	Name, Content string
+}
+
+// AttListDecl is an <!ATTLIST> declaration.
+type AttListDecl struct {
+	Element string
+	Attrs   []AttDef
+}
+
+// AttDef is one attribute definition in an <!ATTLIST> declaration. Type is
+// "CDATA", a tokenized type such as "ID", or an enumeration as written,
+// such as "(en|fr)". Default is "#REQUIRED", "#IMPLIED", "#FIXED", or ""
+// for a plain default value. Value is the default value as written.
+type AttDef struct {
+	Name, Type string
+	Default    string
+	Value      string
+}
+
+// EntityDecl is an <!ENTITY> declaration. An internal entity has Value, its
+// literal as written; an external one has PublicID and SystemID, and an
+// unparsed external one also NData.
+type EntityDecl struct {
+	Name      string
+	Parameter bool
+	Value     string
+	Internal  bool
+
+	PublicID, SystemID string
+	NData              string
+}
+
+// NotationDecl is a <!NOTATION> declaration.
+type NotationDecl struct {
+	Name               string
+	PublicID, SystemID string
+}
+
+// DocType returns the document type declaration, or nil before one has
+// been read.
+func (p *Parser) DocType() *DocType { return p.doctype }
+
+// ErrEntityLimit reports an internal entity whose replacement text exceeds
+// the limit given to WithDTDEntities, or a document whose references to
+// installed entities exceed their total budget.
+var ErrEntityLimit = errors.New("xpp: entity expansion limit exceeded")
+
+var errEntityBudget = fmt.Errorf("%w: entity references in the document expand beyond the budget", ErrEntityLimit)
+
+// DefaultEntityLimit is the per-entity expansion limit WithDTDEntities
+// applies when given a limit of 0.
+const DefaultEntityLimit = 64 << 10
+
+// entityBudgetFactor sets how much the references in one document may
+// expand to in total, as a multiple of the per-entity limit.
+const entityBudgetFactor = 16
+
+// maxEntityDepth bounds how deeply entity values may nest references.
+const maxEntityDepth = 16
+
+// WithDTDEntities installs the internal general entities declared in the
+// document's internal subset into the decoder's Entity map once the
+// DOCTYPE is read, so later text expands them. Character references and
+// references to other entities in a value are expanded at that point; the
+// replacement text is then inserted as character data, so markup in it is
+// not parsed. An entity whose replacement text exceeds limit bytes (0
+// means DefaultEntityLimit), nests too deeply or refers to itself is not
+// installed and is reported in DocType().Errors, which defuses
+// exponential "billion laughs" declarations. Entries already in d.Entity
+// take precedence over declared ones.
+//
+// The references to installed entities in one document may also expand
+// to at most 16 times limit in total (1 MiB by default), which defuses
+// documents that repeat a reference to a large entity; exceeding the
+// budget is an error matching ErrEntityLimit. A parser from NewReader
+// counts references in the raw input as the decoder reads it, before they
+// are expanded. A parser from New cannot see references before its
+// decoder expands them, so it charges each token by how much longer its
+// text and attribute values are than its input, and one token may expand
+// past the budget before the parser fails: use NewReader for untrusted
+// input.
+func WithDTDEntities(limit int) Option {
+	if limit <= 0 {
+		limit = DefaultEntityLimit
+	}
+	return func(p *Parser) { p.entityLimit = limit }
+}
+
+func (p *Parser) processDocType(text string) {
+	rest, ok := strings.CutPrefix(text, "DOCTYPE")
+	if !ok || (rest != "" && !isSpaceByte(rest[0])) {
+		return
+	}
+	p.doctype = parseDocType(rest)
+	if p.decoder == nil {
+		return
+	}
+	if p.entityLimit > 0 {
+		p.installEntities()
+	}
+	if p.dtdDefaults {
+		p.buildAttrDefaults()
+	}
+}
+
+func (p *Parser) installEntities() {
+	dt := p.doctype
+	x := expander{decls: map[string]*EntityDecl{}, known: p.decoder.Entity, limit: p.entityLimit, done: map[string]expansion{}}
+	var names []string
+	for i := range dt.Entities {
+		e := &dt.Entities[i]
+		// The first declaration of an entity is binding.
+		if e.Parameter || x.decls[e.Name] != nil {
+			continue
+		}
+		x.decls[e.Name] = e
+		names = append(names, e.Name)
+	}
+
+	merged := map[string]string{}
+	sizes := map[string]int{}
+	for _, name := range names {
+		if !x.decls[name].Internal {
+			continue
+		}
+		if _, ok := p.decoder.Entity[name]; ok {
+			continue
+		}
+		text, err := x.expand(name, 0)
+		if err != nil {
+			dt.Errors = append(dt.Errors, fmt.Errorf("xpp: entity %s: %w", name, err))
+			continue
+		}
+		merged[name] = text
+		sizes[name] = len(text)
+	}
+	if len(merged) == 0 {
+		return
+	}
+	if p.src != nil {
+		p.src.countRefs(sizes, entityBudgetFactor*p.entityLimit)
+	} else {
+		p.expansion, p.budgeted = entityBudgetFactor*p.entityLimit, true
+	}
+	for k, v := range p.decoder.Entity {
+		merged[k] = v
+	}
+	if p.entityBase == nil {
+		p.entityBase = p.decoder.Entity
+		if p.entityBase == nil {
+			p.entityBase = map[string]string{}
+		}
+	}
+	p.decoder.Entity = merged
+}
+
+// chargeExpansion charges tok, just read by the decoder of a parser from
+// New, against the budget by how much longer its text or attribute values
+// are than the raw input it was read from.
+func (p *Parser) chargeExpansion(tok xml.Token) error {
+	n := 0
+	switch t := tok.(type) {
+	case xml.CharData:
+		n = len(t)
+	case xml.StartElement:
+		for _, a := range t.Attr {
+			n += len(a.Value)
+		}
+	default:
+		return nil
+	}
+	if grew := n - int(p.InputOffset()-p.tokStart); grew > 0 {
+		if p.expansion -= grew; p.expansion < 0 {
+			return errEntityBudget
+		}
+	}
+	return nil
+}
+
+type expansion struct {
+	text string
+	err  error
+}
+
+// expander computes entity replacement texts with memoization, so each
+// entity is expanded at most once however often it is referenced.
+type expander struct {
+	decls  map[string]*EntityDecl
+	known  map[string]string
+	limit  int
+	done   map[string]expansion
+	active []string
+}
+
+func (x *expander) expand(name string, depth int) (string, error) {
+	if r, ok := x.done[name]; ok {
+		return r.text, r.err
+	}
+	for _, a := range x.active {
+		if a == name {
+			return "", errors.New("recursive entity reference")
+		}
+	}
+	if depth > maxEntityDepth {
+		return "", errors.New("entity references nest too deeply")
+	}
+	x.active = append(x.active, name)
+	text, err := x.value(x.decls[name].Value, depth)
+	x.active = x.active[:len(x.active)-1]
+	x.done[name] = expansion{text, err}
+	return text, err
+}
+
+func (x *expander) value(lit string, depth int) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(lit); i++ {
+		c := lit[i]
+		if c == '%' {
+			return "", errors.New("parameter entity reference in entity value")
+		}
+		if c != '&' {
+			sb.WriteByte(c)
+			continue
+		}
+		semi := strings.IndexByte(lit[i:], ';')
+		if semi < 0 {
+			return "", errors.New("unterminated reference in entity value")
+		}
+		ref := lit[i+1 : i+semi]
+		i += semi
+
+		var text string
+		switch d := x.decls[ref]; {
+		case strings.HasPrefix(ref, "#"):
+			r, ok := charRef(ref[1:])
+			if !ok {
+				return "", fmt.Errorf("invalid character reference &%s;", ref)
+			}
+			text = string(r)
+		case predefinedEntities[ref] != "":
+			text = predefinedEntities[ref]
+		case d != nil && d.Internal:
+			var err error
+			if text, err = x.expand(ref, depth+1); err != nil {
+				return "", err
+			}
+		case d != nil:
+			return "", fmt.Errorf("reference to external entity &%s;", ref)
+		default:
+			known, ok := x.known[ref]
+			if !ok {
+				return "", fmt.Errorf("reference to undeclared entity &%s;", ref)
+			}
+			text = known
+		}
+		sb.WriteString(text)
+		if sb.Len() > x.limit {
+			return "", ErrEntityLimit
+		}
+	}
+	if sb.Len() > x.limit {
+		return "", ErrEntityLimit
+	}
+	return sb.String(), nil
+}
+
+// charRef decodes the digits of a character reference, after the '#'.
+func charRef(num string) (rune, bool) {
+	base := 10
+	if hex, ok := strings.CutPrefix(num, "x"); ok {
+		num, base = hex, 16
+	}
+	n, err := strconv.ParseUint(num, base, 32)
+	if err != nil || !utf8.ValidRune(rune(n)) {
+		return 0, false
+	}
+	return rune(n), true
+}
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// dtdScanner reads a DOCTYPE directive's text, which encoding/xml delivers
+// with comments already replaced by spaces.
+type dtdScanner struct {
+	s string
+	i int
+}
+
+func (sc *dtdScanner) eof() bool { return sc.i >= len(sc.s) }
+
+func (sc *dtdScanner) space() {
+	for sc.i < len(sc.s) && isSpaceByte(sc.s[sc.i]) {
+		sc.i++
+	}
+}
+
+func (sc *dtdScanner) peek(lit string) bool { return strings.HasPrefix(sc.s[sc.i:], lit) }
+
+func (sc *dtdScanner) consume(lit string) bool {
+	if sc.peek(lit) {
+		sc.i += len(lit)
+		return true
+	}
+	return false
+}
+
+// token reads a name or keyword: everything up to space or punctuation.
+func (sc *dtdScanner) token() string {
+	start := sc.i
+	for sc.i < len(sc.s) && !isSpaceByte(sc.s[sc.i]) && !strings.ContainsRune(`[]<>()|,"'%;`, rune(sc.s[sc.i])) {
+		sc.i++
+	}
+	return sc.s[start:sc.i]
+}
+
+func (sc *dtdScanner) quoted() (string, error) {
+	if sc.eof() || (sc.s[sc.i] != '"' && sc.s[sc.i] != '\'') {
+		return "", errors.New("expected quoted literal")
+	}
+	q := sc.s[sc.i]
+	end := strings.IndexByte(sc.s[sc.i+1:], q)
+	if end < 0 {
+		return "", errors.New("unterminated literal")
+	}
+	lit := sc.s[sc.i+1 : sc.i+1+end]
+	sc.i += end + 2
+	return lit, nil
+}
+
+// group reads a parenthesized group as written, such as "(a|b)*".
+func (sc *dtdScanner) group() (string, error) {
+	start, depth := sc.i, 0
+	for ; sc.i < len(sc.s); sc.i++ {
+		switch sc.s[sc.i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				sc.i++
+				for sc.i < len(sc.s) && strings.IndexByte("*+?", sc.s[sc.i]) >= 0 {
+					sc.i++
+				}
+				return sc.s[start:sc.i], nil
+			}
+		}
+	}
+	return "", errors.New("unterminated group")
+}
+
+func (sc *dtdScanner) externalID(allowPublicOnly bool) (pub, sys string, err error) {
+	switch {
+	case sc.consume("SYSTEM"):
+		sc.space()
+		sys, err = sc.quoted()
+	case sc.consume("PUBLIC"):
+		sc.space()
+		if pub, err = sc.quoted(); err != nil {
+			return
+		}
+		sc.space()
+		if allowPublicOnly && sc.peek(">") {
+			return
+		}
+		sys, err = sc.quoted()
+	default:
+		err = errors.New("expected SYSTEM or PUBLIC")
+	}
+	return
+}
+
+func (sc *dtdScanner) end() error {
+	sc.space()
+	if !sc.consume(">") {
+		return errors.New("expected '>'")
+	}
+	return nil
+}
+
+// parseDocType parses the text of a DOCTYPE directive after the keyword.
+func parseDocType(text string) *DocType {
+	dt := &DocType{}
+	sc := &dtdScanner{s: text}
+	sc.space()
+	dt.Name = sc.token()
+	sc.space()
+	if sc.peek("SYSTEM") || sc.peek("PUBLIC") {
+		var err error
+		if dt.PublicID, dt.SystemID, err = sc.externalID(false); err != nil {
+			dt.Errors = append(dt.Errors, fmt.Errorf("xpp: DOCTYPE external ID: %w", err))
+		}
+		sc.space()
+	}
+	if !sc.consume("[") {
+		return dt
+	}
+
+	for {
+		sc.space()
+		if sc.eof() || sc.consume("]") {
+			return dt
+		}
+		start := sc.i
+		var err error
+		switch {
+		case sc.consume("<!ELEMENT"):
+			err = dt.parseElement(sc)
+		case sc.consume("<!ATTLIST"):
+			err = dt.parseAttList(sc)
+		case sc.consume("<!ENTITY"):
+			err = dt.parseEntity(sc)
+		case sc.consume("<!NOTATION"):
+			err = dt.parseNotation(sc)
+		case sc.consume("<?"):
+			if end := strings.Index(sc.s[sc.i:], "?>"); end >= 0 {
+				sc.i += end + 2
+			} else {
+				sc.i = len(sc.s)
+			}
+		case sc.consume("%"):
+			sc.token()
+			if !sc.consume(";") {
+				err = errors.New("unterminated parameter entity reference")
+			}
+		default:
+			err = errors.New("unexpected input")
+		}
+		if err != nil {
+			decl := sc.s[start:]
+			if end := strings.IndexByte(decl, '>'); end >= 0 {
+				decl = decl[:end+1]
+			}
+			dt.Errors = append(dt.Errors, fmt.Errorf("xpp: DOCTYPE declaration %q: %w", decl, err))
+			// Resynchronize after the declaration.
+			if end := strings.IndexByte(sc.s[start:], '>'); end >= 0 {
+				sc.i = start + end + 1
+			} else {
+				return dt
+			}
+		}
+	}
+}
+
+func (dt *DocType) parseElement(sc *dtdScanner) error {
+	sc.space()
+	name := sc.token()
+	if name == "" {
+		return errors.New("missing element name")
+	}
+	end := strings.IndexByte(sc.s[sc.i:], '>')
+	if end < 0 {
+		return errors.New("expected '>'")
+	}
+	content := strings.Join(strings.Fields(sc.s[sc.i:sc.i+end]), "")
+	if content == "EMPTY" || content == "ANY" || strings.HasPrefix(content, "(") {
+		sc.i += end + 1
+		dt.Elements = append(dt.Elements, ElementDecl{Name: name, Content: content})
+		return nil
+	}
+	return errors.New("invalid content specification")
+}
+
+func (dt *DocType) parseAttList(sc *dtdScanner) error {
+	sc.space()
+	decl := AttListDecl{Element: sc.token()}
+	if decl.Element == "" {
+		return errors.New("missing element name")
+	}
+	for {
+		sc.space()
+		if sc.consume(">") {
+			dt.AttLists = append(dt.AttLists, decl)
+			return nil
+		}
+		def := AttDef{Name: sc.token()}
+		if def.Name == "" {
+			return errors.New("missing attribute name")
+		}
+		sc.space()
+		var err error
+		switch {
+		case sc.peek("("):
+			def.Type, err = sc.group()
+		case sc.consume("NOTATION"):
+			sc.space()
+			var g string
+			g, err = sc.group()
+			def.Type = "NOTATION " + g
+		default:
+			def.Type = sc.token()
+		}
+		if err != nil {
+			return err
+		}
+		if def.Type == "" {
+			return errors.New("missing attribute type")
+		}
+		sc.space()
+		if sc.peek("#") {
+			sc.i++
+			def.Default = "#" + sc.token()
+			switch def.Default {
+			case "#REQUIRED", "#IMPLIED":
+				decl.Attrs = append(decl.Attrs, def)
+				continue
+			case "#FIXED":
+				sc.space()
+			default:
+				return fmt.Errorf("invalid default %s", def.Default)
+			}
+		}
+		if def.Value, err = sc.quoted(); err != nil {
+			return err
+		}
+		decl.Attrs = append(decl.Attrs, def)
+	}
+}
+
+func (dt *DocType) parseEntity(sc *dtdScanner) error {
+	sc.space()
+	var e EntityDecl
+	if sc.peek("%") && sc.i+1 < len(sc.s) && isSpaceByte(sc.s[sc.i+1]) {
+		sc.i++
+		e.Parameter = true
+		sc.space()
+	}
+	if e.Name = sc.token(); e.Name == "" {
+		return errors.New("missing entity name")
+	}
+	sc.space()
+	var err error
+	if sc.peek(`"`) || sc.peek("'") {
+		e.Internal = true
+		e.Value, err = sc.quoted()
+	} else {
+		e.PublicID, e.SystemID, err = sc.externalID(false)
+		sc.space()
+		if err == nil && !e.Parameter && sc.consume("NDATA") {
+			sc.space()
+			if e.NData = sc.token(); e.NData == "" {
+				err = errors.New("missing NDATA notation name")
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err := sc.end(); err != nil {
+		return err
+	}
+	dt.Entities = append(dt.Entities, e)
+	return nil
+}
+
+func (dt *DocType) parseNotation(sc *dtdScanner) error {
+	sc.space()
+	n := NotationDecl{Name: sc.token()}
+	if n.Name == "" {
+		return errors.New("missing notation name")
+	}
+	sc.space()
+	var err error
+	if n.PublicID, n.SystemID, err = sc.externalID(true); err != nil {
+		return err
+	}
+	if err := sc.end(); err != nil {
+		return err
+	}
+	dt.Notations = append(dt.Notations, n)
+	return nil
+}
+
+// WithDTDDefaults applies the default values declared by ATTLIST
+// declarations in the internal subset: a StartTag that omits an attribute
+// with a declared default (plain or #FIXED) reports it in Attrs and
+// Attribute, after the specified attributes. IsAttributeDefault tells the
+// two apart. Declarations match elements and attributes by their names as
+// written, prefixes included. Default values are normalized as XML
+// requires: references are expanded and whitespace becomes spaces, with
+// runs collapsed for non-CDATA types. Defaulted xmlns attributes are not
+// applied, as they would change the element's own namespace.
+func WithDTDDefaults() Option {
+	return func(p *Parser) { p.dtdDefaults = true }
+}
+
+// IsAttributeDefault reports whether Attrs()[i] on the current StartTag was
+// supplied by a DTD default rather than written in the document. It is
+// always false without WithDTDDefaults.
+func (p *Parser) IsAttributeDefault(i int) bool {
+	return p.event == StartTag && i >= p.specified && i < len(p.attrs)
+}
+
+type attrDefault struct {
+	qname, value string
+}
+
+func (p *Parser) buildAttrDefaults() {
+	p.attrDefaults = map[string][]attrDefault{}
+	seen := map[[2]string]bool{}
+	for _, al := range p.doctype.AttLists {
+		for _, def := range al.Attrs {
+			// The first definition of an attribute is binding.
+			key := [2]string{al.Element, def.Name}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if def.Default == "#REQUIRED" || def.Default == "#IMPLIED" ||
+				def.Name == "xmlns" || strings.HasPrefix(def.Name, "xmlns:") {
+				continue
+			}
+			value := p.normalizeAttr(def.Value, def.Type == "CDATA")
+			p.attrDefaults[al.Element] = append(p.attrDefaults[al.Element], attrDefault{def.Name, value})
+		}
+	}
+}
+
+// applyAttrDefaults appends the declared defaults the current StartTag
+// omits. It runs after the element's namespace scope is pushed, so
+// prefixed attribute names resolve like written ones.
+func (p *Parser) applyAttrDefaults() {
+	defaults := p.attrDefaults[p.elementQName()]
+	if len(defaults) == 0 {
+		return
+	}
+	added := false
+	for _, d := range defaults {
+		name := p.attrName(d.qname)
+		present := false
+		for _, a := range p.attrs[:p.specified] {
+			if a.Name == name {
+				present = true
+				break
+			}
+		}
+		if present {
+			continue
+		}
+		if !added {
+			// Never append into the decoder token's backing array.
+			p.attrs = append(p.attrs[:p.specified:p.specified], xml.Attr{Name: name, Value: d.value})
+			added = true
+			continue
+		}
+		p.attrs = append(p.attrs, xml.Attr{Name: name, Value: d.value})
+	}
+}
+
+// elementQName returns the current element's name as written, or as
+// best reconstructed from its namespace when the raw input is not
+// available.
+func (p *Parser) elementQName() string {
+	if n := len(p.nsStack); n > 0 && p.nsStack[n-1].qname != "" {
+		return p.nsStack[n-1].qname
+	}
+	if p.space == "" {
+		return p.name
+	}
+	prefix, ok := p.PrefixForURI(p.space)
+	switch {
+	case !ok:
+		// encoding/xml leaves an unbound prefix in Space.
+		return p.space + ":" + p.name
+	case prefix == "":
+		return p.name
+	}
+	return prefix + ":" + p.name
+}
+
+// defaultQName returns the qualified name of the defaulted attribute
+// name on the current element.
+func (p *Parser) defaultQName(name xml.Name) string {
+	for _, d := range p.attrDefaults[p.elementQName()] {
+		if p.attrName(d.qname) == name {
+			return d.qname
+		}
+	}
+	return ""
+}
+
+// attrName resolves a qualified attribute name as encoding/xml would.
+func (p *Parser) attrName(qname string) xml.Name {
+	prefix, local, ok := strings.Cut(qname, ":")
+	if !ok {
+		return xml.Name{Local: qname}
+	}
+	if prefix == "xml" {
+		return xml.Name{Space: xmlNSURI, Local: local}
+	}
+	if uri, bound := p.currentBinding(prefix); bound {
+		return xml.Name{Space: uri, Local: local}
+	}
+	return xml.Name{Space: prefix, Local: local}
+}
+
+// normalizeAttr applies attribute-value normalization to a default value
+// literal.
+func (p *Parser) normalizeAttr(lit string, cdata bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(lit); i++ {
+		switch c := lit[i]; c {
+		case '\r':
+			if i+1 < len(lit) && lit[i+1] == '\n' {
+				i++
+			}
+			sb.WriteByte(' ')
+		case '\n', '\t':
+			sb.WriteByte(' ')
+		case '&':
+			semi := strings.IndexByte(lit[i:], ';')
+			if semi < 0 {
+				sb.WriteByte(c)
+				continue
+			}
+			if text, ok := p.expand(lit[i+1 : i+semi]); ok {
+				sb.WriteString(text)
+				i += semi
+				continue
+			}
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	if cdata {
+		return sb.String()
+	}
+	// Only spaces collapse: whitespace from character references stays.
+	return strings.Join(strings.FieldsFunc(sb.String(), func(r rune) bool { return r == ' ' }), " ")
+}
+
+// declaredCDATA reports whether attribute qname of the current element is
+// CDATA, as attributes the internal subset does not declare are.
+func (p *Parser) declaredCDATA(qname string) bool {
+	if p.doctype == nil {
+		return true
+	}
+	element := p.elementQName()
+	for _, al := range p.doctype.AttLists {
+		if al.Element != element {
+			continue
+		}
+		for _, def := range al.Attrs {
+			// The first definition of an attribute is binding.
+			if def.Name == qname {
+				return def.Type == "CDATA"
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,269 @@
+package xpp_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	xpp "github.com/mmcdole/goxpp/v2"
+)
+
+const dtdDoc = `<?xml version="1.0"?>
+<!DOCTYPE rss PUBLIC "-//Example//DTD RSS//EN" "http://example.org/rss.dtd" [
+  <!-- publisher entities -->
+  <!ENTITY company "ACME &amp; Co">
+  <!ENTITY slogan "&company; &#8212; since 1900">
+  <!ENTITY % local "INCLUDE">
+  <!ENTITY logo SYSTEM "logo.gif" NDATA gif>
+  <!ENTITY company "ignored redeclaration">
+  <!ELEMENT rss (channel)>
+  <!ELEMENT br EMPTY>
+  <!ATTLIST rss
+      version CDATA #FIXED "2.0"
+      lang (en | fr) "en"
+      id ID #IMPLIED
+      ref IDREF #REQUIRED>
+  <!NOTATION gif PUBLIC "image/gif">
+  %local;
+  <?publisher ignore?>
+]>
+<rss><title>&slogan;</title></rss>`
+
+func TestDocTypeDeclarations(t *testing.T) {
+	p := newParser(dtdDoc)
+	if p.DocType() != nil {
+		t.Fatal("DocType before the declaration should be nil")
+	}
+	advanceTo(t, p, "rss")
+
+	dt := p.DocType()
+	if dt == nil {
+		t.Fatal("DocType = nil after the declaration")
+	}
+	if dt.Name != "rss" || dt.PublicID != "-//Example//DTD RSS//EN" || dt.SystemID != "http://example.org/rss.dtd" {
+		t.Fatalf("DocType header = %q %q %q", dt.Name, dt.PublicID, dt.SystemID)
+	}
+	if len(dt.Errors) != 0 {
+		t.Fatalf("Errors = %v", dt.Errors)
+	}
+
+	if len(dt.Entities) != 5 {
+		t.Fatalf("Entities = %+v, want 5", dt.Entities)
+	}
+	if e := dt.Entities[0]; e.Name != "company" || !e.Internal || e.Value != "ACME &amp; Co" {
+		t.Fatalf("Entities[0] = %+v", e)
+	}
+	if e := dt.Entities[2]; e.Name != "local" || !e.Parameter {
+		t.Fatalf("Entities[2] = %+v, want parameter entity local", e)
+	}
+	if e := dt.Entities[3]; e.Internal || e.SystemID != "logo.gif" || e.NData != "gif" {
+		t.Fatalf("Entities[3] = %+v, want unparsed external entity", e)
+	}
+
+	if len(dt.Elements) != 2 || dt.Elements[0].Content != "(channel)" || dt.Elements[1].Content != "EMPTY" {
+		t.Fatalf("Elements = %+v", dt.Elements)
+	}
+
+	if len(dt.AttLists) != 1 || dt.AttLists[0].Element != "rss" {
+		t.Fatalf("AttLists = %+v", dt.AttLists)
+	}
+	want := []xpp.AttDef{
+		{Name: "version", Type: "CDATA", Default: "#FIXED", Value: "2.0"},
+		{Name: "lang", Type: "(en | fr)", Value: "en"},
+		{Name: "id", Type: "ID", Default: "#IMPLIED"},
+		{Name: "ref", Type: "IDREF", Default: "#REQUIRED"},
+	}
+	attrs := dt.AttLists[0].Attrs
+	if len(attrs) != len(want) {
+		t.Fatalf("Attrs = %+v", attrs)
+	}
+	for i := range want {
+		if attrs[i] != want[i] {
+			t.Errorf("Attrs[%d] = %+v, want %+v", i, attrs[i], want[i])
+		}
+	}
+
+	if len(dt.Notations) != 1 || dt.Notations[0].Name != "gif" || dt.Notations[0].PublicID != "image/gif" {
+		t.Fatalf("Notations = %+v", dt.Notations)
+	}
+}
+
+func TestDocTypeEntitiesNotInstalledByDefault(t *testing.T) {
+	p := newParser(dtdDoc)
+	advanceTo(t, p, "title")
+	text, err := p.NextText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "&slogan;" {
+		t.Fatalf("NextText = %q, want the reference passed through", text)
+	}
+}
+
+func TestDocTypeEntitiesInstalled(t *testing.T) {
+	p := xpp.NewReader(strings.NewReader(dtdDoc), xpp.WithDTDEntities(0))
+	advanceTo(t, p, "title")
+	text, err := p.NextText()
+	if err != nil {
+		t.Fatalf("NextText in strict mode: %v", err)
+	}
+	if text != "ACME & Co — since 1900" {
+		t.Fatalf("NextText = %q", text)
+	}
+}
+
+func TestDocTypeEntityBudget(t *testing.T) {
+	// Each reference stays under the per-entity limit; repeated, they
+	// would expand to 1.2 GB.
+	big := strings.Repeat("x", 60000)
+	doc := `<!DOCTYPE d [<!ENTITY big "` + big + `">]><d><ok>&big;&big;</ok><a>` +
+		strings.Repeat("&big;", 20000) + `</a></d>`
+	p := xpp.NewReader(strings.NewReader(doc), xpp.WithDTDEntities(0))
+	advanceTo(t, p, "ok")
+	if text, err := p.NextText(); err != nil || len(text) != 120000 {
+		t.Fatalf("ok = %d bytes (%v), want 120000", len(text), err)
+	}
+	if _, err := p.NextTag(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.NextText(); !errors.Is(err, xpp.ErrEntityLimit) {
+		t.Fatalf("NextText = %v, want ErrEntityLimit", err)
+	}
+	if !errors.Is(p.Err(), xpp.ErrEntityLimit) {
+		t.Fatalf("Err() = %v, want the budget error to stick", p.Err())
+	}
+}
+
+func TestDocTypeEntityBudgetNew(t *testing.T) {
+	// Each element stays under the budget; together they would expand
+	// to 1.2 MB.
+	big := strings.Repeat("x", 60000)
+	doc := `<!DOCTYPE d [<!ENTITY big "` + big + `">]><d>` +
+		strings.Repeat(`<a v="&big;">&big;</a>`, 10) + `</d>`
+	p := newParserWith(doc, xpp.WithDTDEntities(0))
+	advanceTo(t, p, "a")
+	if p.Attribute("v") != big {
+		t.Fatalf("v = %d bytes, want 60000", len(p.Attribute("v")))
+	}
+	if text, err := p.NextText(); err != nil || text != big {
+		t.Fatalf("a = %d bytes (%v), want 60000", len(text), err)
+	}
+	var err error
+	for err == nil {
+		_, err = p.NextToken()
+	}
+	if !errors.Is(err, xpp.ErrEntityLimit) {
+		t.Fatalf("NextToken = %v, want ErrEntityLimit", err)
+	}
+}
+
+func TestDocTypeEntityBomb(t *testing.T) {
+	doc := `<!DOCTYPE lolz [
+  <!ENTITY lol "lol">
+  <!ENTITY lol1 "&lol;&lol;&lol;&lol;&lol;&lol;&lol;&lol;&lol;&lol;">
+  <!ENTITY lol2 "&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;">
+  <!ENTITY lol3 "&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;">
+  <!ENTITY lol4 "&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;">
+  <!ENTITY lol5 "&lol4;&lol4;&lol4;&lol4;&lol4;&lol4;&lol4;&lol4;&lol4;&lol4;">
+  <!ENTITY lol9 "&lol5;&lol5;&lol5;&lol5;&lol5;&lol5;&lol5;&lol5;&lol5;&lol5;">
+  <!ENTITY self "a&self;">
+]><lolz><a>&lol2;</a><b>&lol9;</b></lolz>`
+	p := newParserWith(doc, xpp.WithDTDEntities(10000))
+	advanceTo(t, p, "a")
+	text, err := p.NextText()
+	if err != nil || len(text) != 300 {
+		t.Fatalf("lol2 = %d bytes (%v), want 300", len(text), err)
+	}
+
+	dt := p.DocType()
+	var limited, recursive bool
+	for _, err := range dt.Errors {
+		limited = limited || errors.Is(err, xpp.ErrEntityLimit)
+		recursive = recursive || strings.Contains(err.Error(), "recursive")
+	}
+	if !limited || !recursive {
+		t.Fatalf("Errors = %v, want the limit and the recursion reported", dt.Errors)
+	}
+
+	// The bomb is not installed, so the non-strict decoder passes it
+	// through unexpanded.
+	advanceTo(t, p, "b")
+	if text, err := p.NextText(); err != nil || text != "&lol9;" {
+		t.Fatalf("lol9 = %q (%v), want it left unexpanded", text, err)
+	}
+}
+
+func TestDocTypeMalformedDeclarationContinues(t *testing.T) {
+	doc := `<!DOCTYPE r [<!ELEMENT><!ENTITY ok "fine">]><r/>`
+	p := newParser(doc)
+	advanceTo(t, p, "r")
+	dt := p.DocType()
+	if len(dt.Errors) != 1 || len(dt.Entities) != 1 || dt.Entities[0].Value != "fine" {
+		t.Fatalf("Errors %v Entities %+v, want one error and the later entity", dt.Errors, dt.Entities)
+	}
+}
+
+func TestDTDDefaultsApplied(t *testing.T) {
+	doc := `<!DOCTYPE r [
+  <!ENTITY org "ACME">
+  <!ATTLIST item
+      kind (a | b) "  a  "
+      note CDATA "by&#32;&org;
+  staff"
+      version CDATA #FIXED "2.0"
+      id ID #IMPLIED
+      kind CDATA "ignored redeclaration">
+  <!ATTLIST x:meta x:role CDATA "main" xmlns:x CDATA "urn:ignored">
+]>
+<r xmlns:x="urn:x"><item kind="b"/><item/><x:meta/></r>`
+	p := newParserWith(doc, xpp.WithDTDDefaults(), xpp.WithDTDEntities(0))
+
+	advanceTo(t, p, "item")
+	attrs := p.Attrs()
+	if len(attrs) != 3 || attrs[0].Value != "b" || p.IsAttributeDefault(0) {
+		t.Fatalf("first item attrs = %+v, want the specified kind first", attrs)
+	}
+	if !p.IsAttributeDefault(1) || attrs[1].Name.Local != "note" || attrs[1].Value != "by ACME   staff" {
+		t.Fatalf("note = %+v, want the normalized CDATA default", attrs[1])
+	}
+	if attrs[2].Name.Local != "version" || attrs[2].Value != "2.0" {
+		t.Fatalf("version = %+v, want the #FIXED default", attrs[2])
+	}
+
+	advanceTo(t, p, "item")
+	if got := p.Attribute("kind"); got != "a" {
+		t.Fatalf("kind = %q, want the collapsed enumeration default", got)
+	}
+	if p.Attribute("id") != "" || len(p.Attrs()) != 3 {
+		t.Fatalf("attrs = %+v, want no #IMPLIED default", p.Attrs())
+	}
+
+	advanceTo(t, p, "meta")
+	attrs = p.Attrs()
+	if len(attrs) != 1 || attrs[0].Name.Space != "urn:x" || attrs[0].Value != "main" {
+		t.Fatalf("meta attrs = %+v, want x:role resolved and xmlns:x skipped", attrs)
+	}
+}
+
+func TestDTDDefaultsOffByDefault(t *testing.T) {
+	p := newParser(dtdDoc)
+	advanceTo(t, p, "rss")
+	if len(p.Attrs()) != 0 || p.IsAttributeDefault(0) {
+		t.Fatalf("Attrs = %+v, want none without WithDTDDefaults", p.Attrs())
+	}
+}
+
+func TestDTDDefaultsDecodeElement(t *testing.T) {
+	p := xpp.NewReader(strings.NewReader(dtdDoc), xpp.WithDTDDefaults(), xpp.WithDTDEntities(0))
+	advanceTo(t, p, "rss")
+	var v struct {
+		Version string `xml:"version,attr"`
+		Lang    string `xml:"lang,attr"`
+	}
+	if err := p.DecodeElement(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Version != "2.0" || v.Lang != "en" {
+		t.Fatalf("decoded %+v, want the defaults", v)
+	}
+}
@@ -0,0 +1,647 @@
+// Package dsig verifies enveloped XML-DSig signatures read through an
+// xpp.Parser, against keys the caller provides. It never fetches keys or
+// referenced content: only same-document references ("" for the whole
+// document, "#id" for an element) are accepted, and KeyInfo is reported
+// to the caller's KeyFunc by name only.
+//
+// Verify reads its input once. Because an enveloped signature's
+// algorithms are only known once the signed content has been read, the
+// parser's events are recorded to an in-memory tape (xpp.NewRecorder) as
+// they stream, and the tape is replayed once, canonicalizing every
+// SignedInfo and referenced element in that one pass through package
+// c14n. Memory use is therefore proportional to the document.
+//
+// A verified signature covers the referenced elements, not the document:
+// an attacker can move signed content and add unsigned content elsewhere
+// (signature wrapping). Each Reference records the input offset and depth
+// of the element it resolved to; see Reference.Offset for how to check
+// that the element used is the one signed.
+//
+// Supported algorithms are RSA PKCS #1 v1.5, ECDSA and HMAC with SHA-256,
+// SHA-384 or SHA-512; digests SHA-256, SHA-384 and SHA-512; and the
+// enveloped-signature, Canonical XML 1.0 and 1.1 and Exclusive C14N
+// transforms. SHA-1 is not supported. Canonical XML 1.0 is computed as 1.1,
+// which agrees with it unless a referenced element's ancestors carry
+// xml:base or xml:id.
+package dsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"strings"
+
+	xpp "github.com/mmcdole/goxpp/v2"
+	"github.com/mmcdole/goxpp/v2/c14n"
+
+	// Register the hashes the supported algorithms name.
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// Namespace is the XML-DSig namespace URI.
+const Namespace = "http://www.w3.org/2000/09/xmldsig#"
+
+const (
+	envelopedURI = Namespace + "enveloped-signature"
+	c14n10URI    = "http://www.w3.org/TR/2001/REC-xml-c14n-20010315"
+	excNS        = "http://www.w3.org/2001/10/xml-exc-c14n#"
+)
+
+var (
+	// ErrNoSignature reports a document without a Signature element.
+	ErrNoSignature = errors.New("dsig: no signature")
+	// ErrInvalidSignature reports a SignatureValue that does not verify
+	// against the canonical SignedInfo and the key.
+	ErrInvalidSignature = errors.New("dsig: invalid signature")
+	// ErrDigestMismatch reports a reference whose content does not match
+	// its DigestValue.
+	ErrDigestMismatch = errors.New("dsig: digest mismatch")
+	// ErrUnsupportedAlgorithm reports an algorithm or transform this
+	// package does not implement.
+	ErrUnsupportedAlgorithm = errors.New("dsig: unsupported algorithm")
+)
+
+var signatureMethods = map[string]struct {
+	kind string
+	hash crypto.Hash
+}{
+	"http://www.w3.org/2001/04/xmldsig-more#rsa-sha256":   {"rsa", crypto.SHA256},
+	"http://www.w3.org/2001/04/xmldsig-more#rsa-sha384":   {"rsa", crypto.SHA384},
+	"http://www.w3.org/2001/04/xmldsig-more#rsa-sha512":   {"rsa", crypto.SHA512},
+	"http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256": {"ecdsa", crypto.SHA256},
+	"http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha384": {"ecdsa", crypto.SHA384},
+	"http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha512": {"ecdsa", crypto.SHA512},
+	"http://www.w3.org/2001/04/xmldsig-more#hmac-sha256":  {"hmac", crypto.SHA256},
+	"http://www.w3.org/2001/04/xmldsig-more#hmac-sha384":  {"hmac", crypto.SHA384},
+	"http://www.w3.org/2001/04/xmldsig-more#hmac-sha512":  {"hmac", crypto.SHA512},
+}
+
+var digestMethods = map[string]crypto.Hash{
+	"http://www.w3.org/2001/04/xmlenc#sha256":       crypto.SHA256,
+	"http://www.w3.org/2001/04/xmldsig-more#sha384": crypto.SHA384,
+	"http://www.w3.org/2001/04/xmlenc#sha512":       crypto.SHA512,
+}
+
+// canonicalizations maps the canonicalization algorithms to c14n options.
+var canonicalizations = map[string]c14n.Options{
+	c14n10URI:                     {},
+	c14n10URI + "#WithComments":   {Comments: true},
+	c14n.InclusiveURI:             {},
+	c14n.InclusiveWithCommentsURI: {Comments: true},
+	c14n.ExclusiveURI:             {Method: c14n.Exclusive},
+	c14n.ExclusiveWithCommentsURI: {Method: c14n.Exclusive, Comments: true},
+}
+
+// KeyFunc returns the key to verify sig with: an *rsa.PublicKey,
+// *ecdsa.PublicKey or, for HMAC, a []byte secret. It is called once the
+// signature has been read, so it can choose by sig.KeyName and
+// sig.SignatureMethod. A key of the wrong type for the method is an error.
+type KeyFunc func(sig *Signature) (any, error)
+
+// Signature describes a verified ds:Signature.
+type Signature struct {
+	// SignatureMethod is the SignatureMethod algorithm URI.
+	SignatureMethod string
+	// KeyName is the text of KeyInfo's KeyName, "" if there is none.
+	KeyName string
+	// References are the references SignedInfo covers, in order.
+	References []Reference
+
+	offset      int64 // of the Signature start tag
+	signedInfo  int64 // of the SignedInfo start tag
+	c14nMethod  string
+	c14nPrefix  []string
+	signatureV  []byte
+	hasHMACSize bool
+}
+
+// Reference is one ds:Reference, with the element it resolved to.
+type Reference struct {
+	URI string
+	// Space and Name name the referenced element: the document element
+	// for URI "".
+	Space, Name string
+	// Offset and Depth identify the referenced element as the parser
+	// reports its StartTag, through InputOffset and Depth. Callers must
+	// use only content read from that element: reading the document
+	// again, check that the element's StartTag reports the same
+	// InputOffset and Depth, rather than finding it by name or id.
+	Offset int64
+	Depth  int
+
+	transforms []transform
+	digest     string
+	value      []byte
+}
+
+type transform struct {
+	algorithm string
+	prefixes  []string
+}
+
+// Verify reads the document from p, which must be at StartDocument, and
+// verifies every ds:Signature in it against the key returned by key. It
+// returns the signatures on success, ErrNoSignature when there are none,
+// and otherwise the first failure, matching ErrInvalidSignature,
+// ErrDigestMismatch or ErrUnsupportedAlgorithm with errors.Is where one
+// applies. An "#id" reference matches the element whose ID, Id or id
+// attribute, in any namespace, has that value; an id carried by more
+// than one element is an error, and elements inside a Signature are not
+// matched. A Signature's children must follow the schema's order, with
+// exactly one SignedInfo and then one SignatureValue.
+func Verify(p *xpp.Parser, key KeyFunc) ([]*Signature, error) {
+	if p.Event() != xpp.StartDocument {
+		return nil, fmt.Errorf("dsig: parser is on %s, want StartDocument", p.Event())
+	}
+	v := &verifier{ids: map[string]element{}, dups: map[string]bool{}}
+	var tape bytes.Buffer
+	rec := xpp.NewRecorder(p, &tape)
+	defer rec.Stop()
+	var sigs []*Signature
+	for {
+		event, err := p.NextToken()
+		if err != nil {
+			return nil, err
+		}
+		if event == xpp.EndDocument {
+			break
+		}
+		if event != xpp.StartTag {
+			continue
+		}
+		if v.root.offset == 0 {
+			v.root = element{p.InputOffset(), p.Depth(), p.Space(), p.Name()}
+		}
+		v.index(p)
+		if p.Space() == Namespace && p.Name() == "Signature" {
+			sig := &Signature{offset: p.InputOffset()}
+			if err := parseSignature(p, sig); err != nil {
+				return nil, err
+			}
+			sigs = append(sigs, sig)
+		}
+	}
+	rec.Stop()
+	if err := rec.Err(); err != nil {
+		return nil, fmt.Errorf("dsig: recording document: %w", err)
+	}
+	if len(sigs) == 0 {
+		return nil, ErrNoSignature
+	}
+
+	var jobs []*job
+	checks := make([]func() error, len(sigs))
+	for i, sig := range sigs {
+		check, sigJobs, err := v.plan(sig, key)
+		if err != nil {
+			return nil, err
+		}
+		checks[i] = check
+		jobs = append(jobs, sigJobs...)
+	}
+	if err := canonicalize(xpp.Replay(bytes.NewReader(tape.Bytes())), jobs); err != nil {
+		return nil, err
+	}
+	for _, check := range checks {
+		if err := check(); err != nil {
+			return nil, err
+		}
+	}
+	return sigs, nil
+}
+
+type verifier struct {
+	// root is the document element.
+	root element
+	// ids maps each id attribute value to its element; dups records
+	// values seen more than once.
+	ids  map[string]element
+	dups map[string]bool
+}
+
+// element identifies a start tag by its input offset.
+type element struct {
+	offset      int64
+	depth       int
+	space, name string
+}
+
+func (v *verifier) index(p *xpp.Parser) {
+	for _, a := range p.Attrs() {
+		switch a.Name.Local {
+		case "ID", "Id", "id":
+			if a.Name.Space == "xmlns" {
+				continue
+			}
+		default:
+			continue
+		}
+		if _, seen := v.ids[a.Value]; seen {
+			v.dups[a.Value] = true
+		}
+		v.ids[a.Value] = element{p.InputOffset(), p.Depth(), p.Space(), p.Name()}
+	}
+}
+
+// job is one canonicalization of the replay: of the document when offset
+// is 0, else of the subtree of the start tag at offset.
+type job struct {
+	offset int64
+	opts   c14n.Options
+	w      io.Writer
+	c      *c14n.Canonicalizer
+}
+
+// canonicalize runs the jobs over one pass of p.
+func canonicalize(p *xpp.Parser, jobs []*job) error {
+	var active []*job
+	for event := p.Event(); ; {
+		for _, j := range jobs {
+			starts := event == xpp.StartDocument
+			if j.offset != 0 {
+				starts = event == xpp.StartTag && p.InputOffset() == j.offset
+			}
+			if j.c != nil || !starts {
+				continue
+			}
+			c, err := c14n.NewCanonicalizer(j.w, p, j.opts)
+			if err != nil {
+				return err
+			}
+			j.c = c
+			active = append(active, j)
+		}
+		n := 0
+		for _, j := range active {
+			done, err := j.c.Feed()
+			if err != nil {
+				return err
+			}
+			if !done {
+				active[n] = j
+				n++
+			}
+		}
+		active = active[:n]
+		if event == xpp.EndDocument {
+			break
+		}
+		var err error
+		if event, err = p.NextToken(); err != nil {
+			return err
+		}
+	}
+	for _, j := range jobs {
+		if j.c == nil {
+			return errors.New("dsig: element not found on replay")
+		}
+	}
+	return nil
+}
+
+// plan checks sig's structure and algorithms, and returns the
+// canonicalizations its verification needs and the check to run once
+// they are written.
+func (v *verifier) plan(sig *Signature, key KeyFunc) (func() error, []*job, error) {
+	if sig.signedInfo == 0 || sig.signatureV == nil {
+		return nil, nil, errors.New("dsig: Signature lacks SignedInfo or SignatureValue")
+	}
+	if len(sig.References) == 0 {
+		return nil, nil, errors.New("dsig: SignedInfo has no Reference")
+	}
+	opts, ok := canonicalizations[sig.c14nMethod]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: canonicalization %s", ErrUnsupportedAlgorithm, sig.c14nMethod)
+	}
+	opts.InclusivePrefixes = sig.c14nPrefix
+	method, ok := signatureMethods[sig.SignatureMethod]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: signature method %s", ErrUnsupportedAlgorithm, sig.SignatureMethod)
+	}
+	if method.kind == "hmac" && sig.hasHMACSize {
+		// A truncated HMAC weakens the signature to its length.
+		return nil, nil, fmt.Errorf("%w: HMACOutputLength", ErrUnsupportedAlgorithm)
+	}
+	signedInfo := &bytes.Buffer{}
+	jobs := []*job{{offset: sig.signedInfo, opts: opts, w: signedInfo}}
+	digests := make([]hash.Hash, len(sig.References))
+	for i := range sig.References {
+		j, h, err := v.reference(sig, &sig.References[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		jobs = append(jobs, j)
+		digests[i] = h
+	}
+	k, err := key(sig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	check := func() error {
+		// SignedInfo first: the references only matter once the
+		// signature over them holds.
+		if err := checkSignature(method.kind, method.hash, k, signedInfo.Bytes(), sig.signatureV); err != nil {
+			return err
+		}
+		for i, ref := range sig.References {
+			if subtle.ConstantTimeCompare(digests[i].Sum(nil), ref.value) != 1 {
+				return fmt.Errorf("%w for reference %q", ErrDigestMismatch, ref.URI)
+			}
+		}
+		return nil
+	}
+	return check, jobs, nil
+}
+
+// checkSignature verifies value as a signature of the canonical
+// SignedInfo.
+func checkSignature(kind string, hash crypto.Hash, key any, signedInfo, value []byte) error {
+	if kind == "hmac" {
+		secret, ok := key.([]byte)
+		if !ok {
+			return fmt.Errorf("dsig: HMAC signature needs a []byte key, got %T", key)
+		}
+		mac := hmac.New(hash.New, secret)
+		mac.Write(signedInfo)
+		if !hmac.Equal(mac.Sum(nil), value) {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+
+	h := hash.New()
+	h.Write(signedInfo)
+	digest := h.Sum(nil)
+	switch kind {
+	case "rsa":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("dsig: RSA signature needs an *rsa.PublicKey, got %T", key)
+		}
+		if rsa.VerifyPKCS1v15(pub, hash, digest, value) != nil {
+			return ErrInvalidSignature
+		}
+	case "ecdsa":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("dsig: ECDSA signature needs an *ecdsa.PublicKey, got %T", key)
+		}
+		// XML-DSig writes r and s concatenated, each the curve's size.
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(value) != 2*size {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(value[:size])
+		s := new(big.Int).SetBytes(value[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return ErrInvalidSignature
+		}
+	}
+	return nil
+}
+
+// reference resolves ref and returns the canonicalization its digest
+// needs, written to the returned hash.
+func (v *verifier) reference(sig *Signature, ref *Reference) (*job, hash.Hash, error) {
+	digest, ok := digestMethods[ref.digest]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: digest method %s", ErrUnsupportedAlgorithm, ref.digest)
+	}
+	// Same-document references exclude comments; Canonical XML 1.0 is
+	// the default when no transform canonicalizes.
+	var opts c14n.Options
+	enveloped := false
+	for i, t := range ref.transforms {
+		if t.algorithm == envelopedURI {
+			enveloped = true
+			continue
+		}
+		o, ok := canonicalizations[t.algorithm]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: transform %s", ErrUnsupportedAlgorithm, t.algorithm)
+		}
+		if i != len(ref.transforms)-1 {
+			return nil, nil, fmt.Errorf("%w: transform after canonicalization", ErrUnsupportedAlgorithm)
+		}
+		opts = o
+		opts.Comments = false
+		opts.InclusivePrefixes = t.prefixes
+	}
+	if enveloped {
+		opts.Omit = func(p *xpp.Parser) bool {
+			return p.InputOffset() == sig.offset
+		}
+	}
+
+	var el element
+	switch {
+	case ref.URI == "":
+		el = v.root
+	case strings.HasPrefix(ref.URI, "#"):
+		id := ref.URI[1:]
+		if v.dups[id] {
+			return nil, nil, fmt.Errorf("dsig: reference %q matches more than one element", ref.URI)
+		}
+		if el, ok = v.ids[id]; !ok {
+			return nil, nil, fmt.Errorf("dsig: reference %q matches no element", ref.URI)
+		}
+	default:
+		return nil, nil, fmt.Errorf("dsig: reference %q is not a same-document reference", ref.URI)
+	}
+	ref.Space, ref.Name, ref.Offset, ref.Depth = el.space, el.name, el.offset, el.depth
+
+	h := digest.New()
+	j := &job{offset: el.offset, opts: opts, w: h}
+	if ref.URI == "" {
+		// The whole document, with what surrounds the root element.
+		j.offset = 0
+	}
+	return j, h, nil
+}
+
+// The Signature is read in the schema's order, with names matched
+// exactly: the references reported must be the ones the checked
+// SignedInfo lists, so nothing may stand in for or beside it.
+
+// children reads the child elements of the element p is on, in order,
+// calling each with the parser on the child's StartTag. A handler must
+// leave the parser on the child's EndTag.
+func children(p *xpp.Parser, each func(p *xpp.Parser) error) error {
+	for {
+		event, err := p.NextTag()
+		if err != nil {
+			return err
+		}
+		if event == xpp.EndTag {
+			return nil
+		}
+		if err := each(p); err != nil {
+			return err
+		}
+	}
+}
+
+// is reports whether p is on the start tag of the dsig element name.
+func is(p *xpp.Parser, name string) bool {
+	return p.Space() == Namespace && p.Name() == name
+}
+
+func misplaced(p *xpp.Parser, parent, want string) error {
+	return fmt.Errorf("dsig: %s has {%s}%s where %s belongs", parent, p.Space(), p.Name(), want)
+}
+
+// parseSignature reads the Signature element p is on into sig: exactly
+// one SignedInfo, then one SignatureValue, then an optional KeyInfo and
+// any Objects.
+func parseSignature(p *xpp.Parser, sig *Signature) error {
+	n := 0
+	err := children(p, func(p *xpp.Parser) error {
+		n++
+		switch {
+		case n == 1 && is(p, "SignedInfo"):
+			sig.signedInfo = p.InputOffset()
+			return parseSignedInfo(p, sig)
+		case n == 1:
+			return misplaced(p, "Signature", "SignedInfo")
+		case n == 2 && is(p, "SignatureValue"):
+			var err error
+			sig.signatureV, err = base64Text(p)
+			return err
+		case n == 2:
+			return misplaced(p, "Signature", "SignatureValue")
+		case n == 3 && is(p, "KeyInfo"):
+			return children(p, func(p *xpp.Parser) error {
+				if !is(p, "KeyName") {
+					return p.Skip()
+				}
+				name, err := p.NextText()
+				sig.KeyName = strings.TrimSpace(name)
+				return err
+			})
+		case is(p, "Object"):
+			return p.Skip()
+		}
+		return misplaced(p, "Signature", "KeyInfo or Object")
+	})
+	if err == nil && n < 2 {
+		err = errors.New("dsig: Signature lacks SignedInfo or SignatureValue")
+	}
+	return err
+}
+
+// parseSignedInfo reads a SignedInfo: CanonicalizationMethod,
+// SignatureMethod, then one or more References.
+func parseSignedInfo(p *xpp.Parser, sig *Signature) error {
+	n := 0
+	return children(p, func(p *xpp.Parser) error {
+		n++
+		switch {
+		case n == 1 && is(p, "CanonicalizationMethod"):
+			sig.c14nMethod = p.Attribute("Algorithm")
+			return inclusivePrefixes(p, &sig.c14nPrefix)
+		case n == 1:
+			return misplaced(p, "SignedInfo", "CanonicalizationMethod")
+		case n == 2 && is(p, "SignatureMethod"):
+			sig.SignatureMethod = p.Attribute("Algorithm")
+			return children(p, func(p *xpp.Parser) error {
+				if is(p, "HMACOutputLength") {
+					sig.hasHMACSize = true
+				}
+				return p.Skip()
+			})
+		case n == 2:
+			return misplaced(p, "SignedInfo", "SignatureMethod")
+		case is(p, "Reference"):
+			ref := Reference{}
+			found := false
+			for _, a := range p.Attrs() {
+				if a.Name.Space == "" && a.Name.Local == "URI" {
+					ref.URI, found = a.Value, true
+				}
+			}
+			if !found {
+				return errors.New("dsig: Reference without URI")
+			}
+			if err := parseReference(p, &ref); err != nil {
+				return err
+			}
+			sig.References = append(sig.References, ref)
+			return nil
+		}
+		return misplaced(p, "SignedInfo", "Reference")
+	})
+}
+
+// parseReference reads a Reference: optional Transforms, DigestMethod,
+// then DigestValue.
+func parseReference(p *xpp.Parser, ref *Reference) error {
+	n := 0
+	err := children(p, func(p *xpp.Parser) error {
+		n++
+		if n == 1 && is(p, "Transforms") {
+			return children(p, func(p *xpp.Parser) error {
+				if !is(p, "Transform") {
+					return misplaced(p, "Transforms", "Transform")
+				}
+				t := transform{algorithm: p.Attribute("Algorithm")}
+				if err := inclusivePrefixes(p, &t.prefixes); err != nil {
+					return err
+				}
+				ref.transforms = append(ref.transforms, t)
+				return nil
+			})
+		}
+		switch {
+		case ref.digest == "" && ref.value == nil && is(p, "DigestMethod"):
+			ref.digest = p.Attribute("Algorithm")
+			return p.Skip()
+		case ref.digest == "":
+			return misplaced(p, "Reference", "DigestMethod")
+		case ref.value == nil && is(p, "DigestValue"):
+			var err error
+			ref.value, err = base64Text(p)
+			return err
+		}
+		return misplaced(p, "Reference", "DigestValue")
+	})
+	if err == nil && ref.value == nil {
+		err = fmt.Errorf("dsig: Reference %q lacks DigestValue", ref.URI)
+	}
+	return err
+}
+
+// inclusivePrefixes reads the Exclusive C14N InclusiveNamespaces child of
+// a CanonicalizationMethod or Transform into prefixes, skipping others.
+func inclusivePrefixes(p *xpp.Parser, prefixes *[]string) error {
+	return children(p, func(p *xpp.Parser) error {
+		if p.Space() == excNS && p.Name() == "InclusiveNamespaces" {
+			*prefixes = strings.Fields(p.Attribute("PrefixList"))
+		}
+		return p.Skip()
+	})
+}
+
+// base64Text reads the base64 text of the element p is on.
+func base64Text(p *xpp.Parser) ([]byte, error) {
+	text, err := p.NextText()
+	if err != nil {
+		return nil, err
+	}
+	text = strings.Join(strings.Fields(text), "")
+	value, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return nil, fmt.Errorf("dsig: %s: %w", p.Name(), err)
+	}
+	return value, nil
+}
@@ -0,0 +1,270 @@
+package dsig_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	xpp "github.com/mmcdole/goxpp/v2"
+	"github.com/mmcdole/goxpp/v2/c14n"
+	"github.com/mmcdole/goxpp/v2/dsig"
+)
+
+const (
+	rsaSHA256   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	ecdsaSHA256 = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256"
+	hmacSHA256  = "http://www.w3.org/2001/04/xmldsig-more#hmac-sha256"
+)
+
+// canonicalFeed is the signed feed without its signature, written in
+// canonical form so the test does not depend on package c14n for it.
+const canonicalFeed = `<feed xmlns="urn:feed" Id="f1"><title>Partner &amp; Co</title></feed>`
+
+// signedFeed returns the feed with an enveloped signature over uri,
+// signed by sign. The SignedInfo is written in canonical form for
+// canonicalization method c14nMethod, so its bytes are what gets signed.
+func signedFeed(c14nMethod, method, uri string, sign func(signedInfo []byte) []byte) string {
+	return signed(`<feed xmlns="urn:feed" Id="f1"><title>Partner &amp; Co</title>`, canonicalFeed,
+		c14nMethod, method, uri, sign)
+}
+
+// signed returns the document opened by head, with an enveloped signature
+// before its closing tag. canonical is the document's Exclusive canonical
+// form without the signature.
+func signed(head, canonical, c14nMethod, method, uri string, sign func(signedInfo []byte) []byte) string {
+	digest := sha256.Sum256([]byte(canonical))
+	signedInfo := `<SignedInfo xmlns="http://www.w3.org/2000/09/xmldsig#">` +
+		`<CanonicalizationMethod Algorithm="` + c14nMethod + `"></CanonicalizationMethod>` +
+		`<SignatureMethod Algorithm="` + method + `"></SignatureMethod>` +
+		`<Reference URI="` + uri + `"><Transforms>` +
+		`<Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"></Transform>` +
+		`<Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"></Transform>` +
+		`</Transforms><DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"></DigestMethod>` +
+		`<DigestValue>` + base64.StdEncoding.EncodeToString(digest[:]) + `</DigestValue></Reference></SignedInfo>`
+	value := base64.StdEncoding.EncodeToString(sign([]byte(signedInfo)))
+	// Wrap the signature value as signers commonly do.
+	value = value[:20] + "\n  " + value[20:]
+	return `<?xml version="1.0"?>
+<!-- partner feed -->` + head +
+		`<Signature xmlns="http://www.w3.org/2000/09/xmldsig#">` + signedInfo +
+		`<SignatureValue>` + value + `</SignatureValue>` +
+		`<KeyInfo><KeyName>partner</KeyName></KeyInfo></Signature></feed>`
+}
+
+func verify(doc string, key any) ([]*dsig.Signature, error) {
+	p := xpp.NewReader(strings.NewReader(doc))
+	return dsig.Verify(p, func(*dsig.Signature) (any, error) { return key, nil })
+}
+
+func rsaSigner(t *testing.T) (*rsa.PrivateKey, func([]byte) []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, func(signedInfo []byte) []byte {
+		digest := sha256.Sum256(signedInfo)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+}
+
+func TestVerifyRSA(t *testing.T) {
+	key, sign := rsaSigner(t)
+	doc := signedFeed(c14n.ExclusiveURI, rsaSHA256, "", sign)
+	sigs, err := verify(doc, &key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sigs) != 1 {
+		t.Fatalf("got %d signatures, want 1", len(sigs))
+	}
+	sig := sigs[0]
+	if sig.KeyName != "partner" || sig.SignatureMethod != rsaSHA256 {
+		t.Errorf("KeyName, SignatureMethod = %q, %q", sig.KeyName, sig.SignatureMethod)
+	}
+	if len(sig.References) != 1 || sig.References[0].Space != "urn:feed" || sig.References[0].Name != "feed" {
+		t.Errorf("References = %+v, want the feed element", sig.References)
+	}
+	if !signedElement(t, doc, sig.References[0], "feed") {
+		t.Errorf("reference %+v does not identify the feed element", sig.References[0])
+	}
+
+	tampered := strings.Replace(doc, "Partner", "Impostor", 1)
+	if _, err := verify(tampered, &key.PublicKey); !errors.Is(err, dsig.ErrDigestMismatch) {
+		t.Errorf("tampered content: err = %v, want ErrDigestMismatch", err)
+	}
+
+	other, _ := rsaSigner(t)
+	if _, err := verify(doc, &other.PublicKey); !errors.Is(err, dsig.ErrInvalidSignature) {
+		t.Errorf("wrong key: err = %v, want ErrInvalidSignature", err)
+	}
+	if _, err := verify(doc, []byte("secret")); err == nil {
+		t.Error("HMAC key for an RSA signature: err = nil")
+	}
+}
+
+func TestVerifyECDSA(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := signedFeed(c14n.ExclusiveURI, ecdsaSHA256, "#f1", func(signedInfo []byte) []byte {
+		digest := sha256.Sum256(signedInfo)
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	})
+	sigs, err := verify(doc, &key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref := sigs[0].References[0]; ref.URI != "#f1" || ref.Name != "feed" {
+		t.Errorf("reference = %+v, want #f1 resolved to feed", ref)
+	}
+
+	if !signedElement(t, doc, sigs[0].References[0], "feed") {
+		t.Errorf("reference %+v does not identify the feed element", sigs[0].References[0])
+	}
+
+	wrapped := strings.Replace(doc, "<title>", `<title><dup Id="f1"/>`, 1)
+	if _, err := verify(wrapped, &key.PublicKey); err == nil || errors.Is(err, dsig.ErrDigestMismatch) {
+		t.Errorf("duplicate id: err = %v, want a reference error", err)
+	}
+}
+
+func TestVerifyHMAC(t *testing.T) {
+	secret := []byte("shared secret")
+	doc := signedFeed(c14n.InclusiveURI, hmacSHA256, "", func(signedInfo []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signedInfo)
+		return mac.Sum(nil)
+	})
+	if _, err := verify(doc, secret); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verify(doc, []byte("guess")); !errors.Is(err, dsig.ErrInvalidSignature) {
+		t.Errorf("wrong secret: err = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	key, sign := rsaSigner(t)
+	tests := []struct {
+		name string
+		doc  string
+		want error
+	}{
+		{"no signature", canonicalFeed, dsig.ErrNoSignature},
+		{"external reference", signedFeed(c14n.ExclusiveURI, rsaSHA256, "http://example.com/feed", sign), nil},
+		{"SHA-1", signedFeed(c14n.ExclusiveURI, "http://www.w3.org/2000/09/xmldsig#rsa-sha1", "", sign), dsig.ErrUnsupportedAlgorithm},
+		{"canonicalization", signedFeed("urn:unknown", rsaSHA256, "", sign), dsig.ErrUnsupportedAlgorithm},
+	}
+	for _, tt := range tests {
+		_, err := verify(tt.doc, &key.PublicKey)
+		if err == nil || tt.want != nil && !errors.Is(err, tt.want) || errors.Is(err, dsig.ErrInvalidSignature) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+// signedElement reports whether ref identifies the element name when doc
+// is read again, as the Reference documentation describes.
+func signedElement(t *testing.T, doc string, ref dsig.Reference, name string) bool {
+	t.Helper()
+	p := xpp.NewReader(strings.NewReader(doc))
+	for {
+		event, err := p.NextToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event == xpp.EndDocument {
+			return false
+		}
+		if event == xpp.StartTag && p.InputOffset() == ref.Offset && p.Depth() == ref.Depth {
+			return p.Name() == name
+		}
+	}
+}
+
+func TestVerifyDefaultAndPrefix(t *testing.T) {
+	// The feed namespace is bound both as the default and to f, so the
+	// canonical form depends on the prefixes as written.
+	key, sign := rsaSigner(t)
+	doc := signed(`<feed xmlns="urn:feed" xmlns:f="urn:feed" Id="f1"><f:title>Partner &amp; Co</f:title>`,
+		`<feed xmlns="urn:feed" Id="f1"><f:title xmlns:f="urn:feed">Partner &amp; Co</f:title></feed>`,
+		c14n.ExclusiveURI, rsaSHA256, "#f1", sign)
+	if _, err := verify(doc, &key.PublicKey); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyKeepsCallerRecorder(t *testing.T) {
+	key, sign := rsaSigner(t)
+	doc := signedFeed(c14n.ExclusiveURI, rsaSHA256, "", sign)
+	var tape bytes.Buffer
+	p := xpp.NewReader(strings.NewReader(doc))
+	rec := xpp.NewRecorder(p, &tape)
+	if _, err := dsig.Verify(p, func(*dsig.Signature) (any, error) { return &key.PublicKey, nil }); err != nil {
+		t.Fatal(err)
+	}
+	rec.Stop()
+	// The caller's own recorder kept recording alongside Verify's.
+	r := xpp.Replay(&tape)
+	for r.Event() != xpp.EndDocument {
+		if _, err := r.NextToken(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestVerifyRejectsWrapping(t *testing.T) {
+	secret := []byte("shared secret")
+	doc := signedFeed(c14n.ExclusiveURI, hmacSHA256, "#f1", func(signedInfo []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signedInfo)
+		return mac.Sum(nil)
+	})
+	between := func(open, close string) string {
+		i := strings.Index(doc, open)
+		j := strings.Index(doc, close) + len(close)
+		return doc[i:j]
+	}
+	signedInfo := between("<SignedInfo", "</SignedInfo>")
+	value := between("<SignatureValue>", "</SignatureValue>")
+	// An unsigned SignedInfo whose reference digests correctly.
+	injected := strings.Replace(signedInfo, `URI="#f1"`, `URI=""`, 1)
+
+	tests := []struct {
+		name, doc string
+	}{
+		{"extra SignedInfo first", strings.Replace(doc, signedInfo, injected+signedInfo, 1)},
+		{"extra SignedInfo after", strings.Replace(doc, signedInfo, signedInfo+injected, 1)},
+		{"case-folded SignedInfo", strings.Replace(doc, signedInfo,
+			strings.ReplaceAll(injected, "SignedInfo", "signedinfo")+signedInfo, 1)},
+		{"duplicate SignatureValue", strings.Replace(doc, value, value+value, 1)},
+		{"SignatureValue first", strings.Replace(doc, signedInfo+value, value+signedInfo, 1)},
+	}
+	if _, err := verify(doc, secret); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		if sigs, err := verify(tt.doc, secret); err == nil {
+			t.Errorf("%s: verified references %+v, want an error", tt.name, sigs[0].References)
+		}
+	}
+}
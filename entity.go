@@ -0,0 +1,192 @@
+package xpp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"unicode"
+)
+
+//go:generate go run ./internal/cmd/genentities -o htmlentities.go
+
+// HTMLEntities maps the HTML5 named character references to their
+// replacement text, keyed without the '&' and ';', in the form
+// xml.Decoder.Entity expects. It is the full WHATWG table, a superset of
+// encoding/xml's HTML 4 HTMLEntity map. Treat it as read-only: parsers
+// created with WithHTMLEntities share it.
+var HTMLEntities = htmlEntities
+
+// WithHTMLEntities installs HTMLEntities into the decoder's Entity map, so
+// references such as &nbsp; and &eacute; decode in both strict and
+// non-strict mode. Entries already in d.Entity take precedence.
+func WithHTMLEntities() Option {
+	return func(p *Parser) {
+		if p.decoder == nil {
+			return
+		}
+		if len(p.decoder.Entity) == 0 {
+			p.decoder.Entity = HTMLEntities
+			return
+		}
+		merged := make(map[string]string, len(HTMLEntities)+len(p.decoder.Entity))
+		for k, v := range HTMLEntities {
+			merged[k] = v
+		}
+		for k, v := range p.decoder.Entity {
+			merged[k] = v
+		}
+		p.decoder.Entity = merged
+	}
+}
+
+// EntityResolver supplies replacement text for an entity reference the
+// decoder does not know. It reports ok=false to leave the reference
+// unresolved.
+type EntityResolver func(name string) (text string, ok bool)
+
+// WithEntityRefs makes a parser from NewReader report references to
+// undeclared entities in text content as EntityRef events instead of
+// failing (strict decoder) or passing them through as literal text
+// (non-strict decoder). Predefined, numeric and d.Entity references are
+// still expanded into the surrounding Text. Malformed references and
+// undeclared references in attribute values are errors as before. A parser
+// from New ignores this option.
+func WithEntityRefs() Option {
+	return func(p *Parser) { p.entityRefs = true }
+}
+
+// WithEntityResolver is WithEntityRefs with r consulted for each
+// undeclared reference. A resolved EntityRef carries the replacement in
+// Text, and Next and NextText read it as that text; an unresolved one
+// reads as the literal reference.
+func WithEntityResolver(r EntityResolver) Option {
+	return func(p *Parser) {
+		p.entityRefs = true
+		p.resolver = r
+	}
+}
+
+var predefinedEntities = map[string]string{
+	"lt":   "<",
+	"gt":   ">",
+	"amp":  "&",
+	"apos": "'",
+	"quot": `"`,
+}
+
+// splitUndeclared handles a strict decoder's rejection of the text token
+// at tokStart. If the text is well-formed apart from undeclared entity
+// references, it delivers the text split around them, restarts the
+// decoder at the markup that follows and reports true.
+func (p *Parser) splitUndeclared(err error) bool {
+	var serr *xml.SyntaxError
+	if !errors.As(err, &serr) || !strings.Contains(serr.Msg, "entity") {
+		return false
+	}
+	if first := p.src.bytes(p.tokStart, p.tokStart+1); len(first) == 0 || first[0] == '<' {
+		return false
+	}
+	end := p.src.indexFrom(p.tokStart, '<')
+	if end < 0 {
+		return false
+	}
+	pieces, ok := p.splitRefs(p.src.bytes(p.tokStart, end))
+	if !ok || len(pieces) == 0 {
+		return false
+	}
+	if p.restart(end) != nil {
+		return false
+	}
+	p.deliver(pieces)
+	return true
+}
+
+// deliver makes the first piece the current token and queues the rest.
+func (p *Parser) deliver(pieces []queued) {
+	first := pieces[0]
+	p.token = nil
+	p.event, p.name, p.text, p.refOK = first.event, first.name, first.text, first.refOK
+	p.queue = append(p.queue, pieces[1:]...)
+}
+
+// splitRefs decodes raw character data into Text and EntityRef pieces,
+// one EntityRef per undeclared reference. It reports false if raw holds a
+// malformed reference.
+func (p *Parser) splitRefs(raw []byte) ([]queued, bool) {
+	var pieces []queued
+	var sb strings.Builder
+	flush := func() {
+		if sb.Len() > 0 {
+			pieces = append(pieces, queued{event: Text, text: sb.String()})
+			sb.Reset()
+		}
+	}
+	for i := 0; i < len(raw); i++ {
+		switch c := raw[i]; c {
+		case '\r':
+			// Line ends are normalized as the decoder does.
+			sb.WriteByte('\n')
+			if i+1 < len(raw) && raw[i+1] == '\n' {
+				i++
+			}
+			continue
+		case '&':
+		default:
+			sb.WriteByte(c)
+			continue
+		}
+		semi := bytes.IndexByte(raw[i+1:], ';')
+		if semi < 0 {
+			return nil, false
+		}
+		name := string(raw[i+1 : i+1+semi])
+		i += semi + 1
+		if text, ok := p.expand(name); ok {
+			sb.WriteString(text)
+			continue
+		}
+		if !isName(name) {
+			return nil, false
+		}
+		flush()
+		q := queued{event: EntityRef, name: name}
+		if p.resolver != nil {
+			q.text, q.refOK = p.resolver(name)
+		}
+		pieces = append(pieces, q)
+	}
+	flush()
+	return pieces, true
+}
+
+// expand returns the text of a reference the decoder itself would expand.
+func (p *Parser) expand(name string) (string, bool) {
+	if text, ok := predefinedEntities[name]; ok {
+		return text, true
+	}
+	if num, ok := strings.CutPrefix(name, "#"); ok {
+		r, ok := charRef(num)
+		if !ok {
+			return "", false
+		}
+		return string(r), true
+	}
+	text, ok := p.decoder.Entity[name]
+	return text, ok
+}
+
+func isName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case unicode.IsLetter(r) || r == '_' || r == ':':
+		case i > 0 && (unicode.IsDigit(r) || unicode.IsMark(r) || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,170 @@
+package xpp_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	xpp "github.com/mmcdole/goxpp/v2"
+)
+
+func TestHTMLEntitiesNextText(t *testing.T) {
+	doc := `<root><t>a&nbsp;caf&eacute;&mdash;&NotEqualTilde;&amp;&#65;</t></root>`
+	for _, strict := range []bool{true, false} {
+		d := xml.NewDecoder(bytes.NewReader([]byte(doc)))
+		d.Strict = strict
+		p := xpp.New(d, xpp.WithHTMLEntities())
+		advanceTo(t, p, "t")
+
+		text, err := p.NextText()
+		if err != nil {
+			t.Fatalf("strict=%v: NextText: %v", strict, err)
+		}
+		want := "a café—≂̸&A"
+		if text != want {
+			t.Fatalf("strict=%v: NextText = %q, want %q", strict, text, want)
+		}
+	}
+}
+
+func TestHTMLEntitiesWithoutOption(t *testing.T) {
+	p := newParser(`<t>&eacute;</t>`)
+	advanceTo(t, p, "t")
+	text, err := p.NextText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "&eacute;" {
+		t.Fatalf("NextText = %q, want the reference passed through", text)
+	}
+}
+
+func TestHTMLEntitiesKeepDecoderEntries(t *testing.T) {
+	d := xml.NewDecoder(strings.NewReader(`<t>&eacute;&custom;</t>`))
+	d.Entity = map[string]string{"eacute": "E", "custom": "C"}
+	p := xpp.New(d, xpp.WithHTMLEntities())
+	advanceTo(t, p, "t")
+	text, err := p.NextText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "EC" {
+		t.Fatalf("NextText = %q, want the decoder's own entries to win", text)
+	}
+	if xpp.HTMLEntities["eacute"] != "é" {
+		t.Fatal("merging must not modify HTMLEntities")
+	}
+}
+
+func TestHTMLEntitiesTable(t *testing.T) {
+	if n := len(xpp.HTMLEntities); n < 2000 {
+		t.Fatalf("len(HTMLEntities) = %d, want the full HTML5 table", n)
+	}
+	// Every HTML 4 entity encoding/xml knows is covered with the same text,
+	// except the two HTML5 remapped to the mathematical angle brackets.
+	for name, want := range xml.HTMLEntity {
+		switch name {
+		case "lang":
+			want = "\u27e8"
+		case "rang":
+			want = "\u27e9"
+		}
+		if got := xpp.HTMLEntities[name]; got != want {
+			t.Errorf("HTMLEntities[%q] = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestEntityRefEvents(t *testing.T) {
+	doc := "<root>a &amp; &foo;\r\nb&#65;&bar;</root>"
+	for _, strict := range []bool{true, false} {
+		p := xpp.NewReader(strings.NewReader(doc), xpp.WithEntityRefs())
+		p.Decoder().Strict = strict
+
+		got := strings.Join(collect(t, p), " ")
+		want := "StartTag:root Text:a &  EntityRef:foo Text:\nbA EntityRef:bar EndTag:root"
+		if got != want {
+			t.Fatalf("strict=%v: tokens = %q\nwant            %q", strict, got, want)
+		}
+	}
+}
+
+func TestEntityRefLoneNonStrict(t *testing.T) {
+	resolve := func(name string) (string, bool) { return "ACME", name == "foo" }
+	for _, strict := range []bool{true, false} {
+		p := xpp.NewReader(strings.NewReader(`<r>&foo;</r>`), xpp.WithEntityResolver(resolve))
+		p.Decoder().Strict = strict
+		got := strings.Join(collect(t, p), " ")
+		if want := "StartTag:r EntityRef:foo EndTag:r"; got != want {
+			t.Fatalf("strict=%v: tokens = %q, want %q", strict, got, want)
+		}
+
+		p = xpp.NewReader(strings.NewReader(`<r>&foo;</r>`), xpp.WithEntityResolver(resolve))
+		p.Decoder().Strict = strict
+		advanceTo(t, p, "r")
+		if text, err := p.NextText(); err != nil || text != "ACME" {
+			t.Fatalf("strict=%v: NextText = %q (%v), want the resolved text", strict, text, err)
+		}
+	}
+}
+
+func TestEntityRefNameAndNext(t *testing.T) {
+	p := xpp.NewReader(strings.NewReader(`<root><a>x &foo; y</a><b>&foo;</b></root>`), xpp.WithEntityRefs())
+	advanceTo(t, p, "a")
+
+	if _, err := p.NextToken(); err != nil {
+		t.Fatal(err)
+	}
+	tok, err := p.NextToken()
+	if err != nil || tok != xpp.EntityRef || p.Name() != "foo" || p.Text() != "" {
+		t.Fatalf("NextToken = %v %q %q (%v), want unresolved EntityRef foo", tok, p.Name(), p.Text(), err)
+	}
+
+	// Next and NextText read an unresolved reference literally.
+	advanceTo(t, p, "b")
+	text, err := p.NextText()
+	if err != nil || text != "&foo;" {
+		t.Fatalf("NextText = %q (%v), want the literal reference", text, err)
+	}
+}
+
+func TestEntityResolver(t *testing.T) {
+	resolve := func(name string) (string, bool) {
+		if name == "company" {
+			return "ACME", true
+		}
+		return "", false
+	}
+	doc := `<root><t>&company; &other;</t></root>`
+	p := xpp.NewReader(strings.NewReader(doc), xpp.WithEntityResolver(resolve))
+	advanceTo(t, p, "t")
+
+	tok, err := p.NextToken()
+	if err != nil || tok != xpp.EntityRef || p.Name() != "company" || p.Text() != "ACME" {
+		t.Fatalf("NextToken = %v %q %q (%v), want resolved EntityRef", tok, p.Name(), p.Text(), err)
+	}
+
+	p = xpp.NewReader(strings.NewReader(doc), xpp.WithEntityResolver(resolve))
+	advanceTo(t, p, "t")
+	text, err := p.NextText()
+	if err != nil || text != "ACME &other;" {
+		t.Fatalf("NextText = %q (%v), want ACME &other;", text, err)
+	}
+}
+
+func TestEntityRefMalformedStillFails(t *testing.T) {
+	p := xpp.NewReader(strings.NewReader(`<root>a & b</root>`), xpp.WithEntityRefs())
+	advanceTo(t, p, "root")
+	if _, err := p.NextToken(); err == nil {
+		t.Fatal("a bare '&' is not an entity reference and should still fail")
+	}
+}
+
+func TestEntityRefsKnownEntitiesStayText(t *testing.T) {
+	p := xpp.NewReader(strings.NewReader(`<root>&eacute;</root>`), xpp.WithEntityRefs(), xpp.WithHTMLEntities())
+	got := strings.Join(collect(t, p), " ")
+	if got != "StartTag:root Text:é EndTag:root" {
+		t.Fatalf("tokens = %q", got)
+	}
+}
@@ -0,0 +1,225 @@
+package xpp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+)
+
+// ErrNeedMoreInput is returned by a Feeder's NextToken when the input
+// written so far ends inside the next token. It does not poison the
+// parser: the cursor stays where it was, and the call succeeds once more
+// input has been written.
+var ErrNeedMoreInput = errors.New("xpp: need more input")
+
+// Feeder is a parser that is pushed its input, for callers such as event
+// loops that receive XML in chunks and cannot block in a Read. Write
+// appends input and Close marks its end; in between, NextToken and Next
+// return ErrNeedMoreInput whenever they run out of input, and resume from
+// the same token when called again. A Feeder has the raw-input features
+// of a parser from NewReader.
+//
+// Methods that consume several tokens, such as NextText, Skip and Bind,
+// stop wherever the input ran out, with the cursor inside the element;
+// call them once the element has been written in full. DecodeElement
+// reads from the decoder directly, so ErrNeedMoreInput from it poisons
+// the parser.
+type Feeder struct {
+	*Parser
+	in *feedBuffer
+}
+
+// NewFeeder returns a Feeder with no input yet.
+func NewFeeder(opts ...Option) *Feeder {
+	in := &feedBuffer{}
+	p := NewReader(in, opts...)
+	p.feed = in
+	return &Feeder{Parser: p, in: in}
+}
+
+// Write appends b to the input. It fails after Close.
+func (f *Feeder) Write(b []byte) (int, error) {
+	if f.in.closed {
+		return 0, errors.New("xpp: write to closed Feeder")
+	}
+	f.in.buf = append(f.in.buf, b...)
+	return len(b), nil
+}
+
+// Close marks the end of the input: a document still incomplete then is a
+// syntax error, as it would be from a reader.
+func (f *Feeder) Close() error {
+	f.in.closed = true
+	return nil
+}
+
+// feedBuffer holds the input written to a Feeder that the parser has not
+// read yet. scanned is how far the token at scanTok has been searched for
+// its end, so each written byte is scanned once per token.
+type feedBuffer struct {
+	buf    []byte
+	r      int
+	closed bool
+
+	scanTok, scanned int64
+}
+
+func (b *feedBuffer) ReadByte() (byte, error) {
+	if b.r == len(b.buf) {
+		b.buf, b.r = b.buf[:0], 0
+		if b.closed {
+			return 0, io.EOF
+		}
+		return 0, ErrNeedMoreInput
+	}
+	c := b.buf[b.r]
+	b.r++
+	return c, nil
+}
+
+func (b *feedBuffer) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	c, err := b.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	p[0] = c
+	return 1, nil
+}
+
+// textCut reports whether tok is character data that the decoder ended
+// only because the written input ran out; encoding/xml returns the text
+// read so far in that case. Text that ends at markup is followed by the
+// '<' the decoder read and put back.
+func (p *Parser) textCut(tok xml.Token) bool {
+	if _, ok := tok.(xml.CharData); !ok || p.feed.closed {
+		return false
+	}
+	end := p.InputOffset()
+	return !bytes.Equal(p.src.bytes(end, end+1), []byte("<"))
+}
+
+// feedReady reports whether the input written so far holds the end of
+// the token at raw offset off, so the decoder can be run without running
+// out of input. Until then NextToken returns ErrNeedMoreInput without
+// touching the decoder, which keeps feeding a large token linear.
+func (p *Parser) feedReady(off int64) bool {
+	f := p.feed
+	if f.closed {
+		return true
+	}
+	held := p.src.base + int64(len(p.src.buf))
+	end := held + int64(len(f.buf)-f.r)
+	at := func(i int64) byte {
+		if i < held {
+			return p.src.buf[i-p.src.base]
+		}
+		return f.buf[f.r+int(i-held)]
+	}
+	if off >= end {
+		return false
+	}
+	if f.scanTok != off {
+		f.scanTok, f.scanned = off, off
+	}
+
+	open, term := "", "<"
+	if at(off) == '<' {
+		open, term = "<", ">"
+		for _, m := range [...]struct{ open, term string }{
+			{"<!--", "-->"},
+			{"<![CDATA[", "]]>"},
+			{"<?", "?>"},
+		} {
+			n := min(int64(len(m.open)), end-off)
+			matched := true
+			for i := int64(0); i < n; i++ {
+				if at(off+i) != m.open[i] {
+					matched = false
+					break
+				}
+			}
+			if !matched {
+				continue
+			}
+			if n < int64(len(m.open)) {
+				return false
+			}
+			open, term = m.open, m.term
+			break
+		}
+	}
+
+	from := max(f.scanned-int64(len(term))+1, off+int64(len(open)))
+	for i := from; i+int64(len(term)) <= end; i++ {
+		found := true
+		for j := range term {
+			if at(i+int64(j)) != term[j] {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	f.scanned = end
+	return false
+}
+
+// feedMark is the cursor state NextToken changes before it reads from
+// the decoder, saved by a Feeder to undo a read that runs out of input.
+type feedMark struct {
+	token       xml.Token
+	event       EventType
+	name, space string
+	text        string
+	cdata       bool
+	attrs       []xml.Attr
+	depth       int
+	nsLen       int
+	baseLen     int
+	pendingPop  bool
+	tokStart    int64
+	refOK       bool
+	specified   int
+	written     []writtenAttr
+	writtenDone bool
+	procInst    *ProcInst
+}
+
+func (p *Parser) feedMark() feedMark {
+	return feedMark{
+		token: p.token, event: p.event, name: p.name, space: p.space,
+		text: p.text, cdata: p.cdata, attrs: p.attrs, depth: p.depth,
+		nsLen: len(p.nsStack), baseLen: len(p.baseStack),
+		pendingPop: p.pendingPop, tokStart: p.tokStart, refOK: p.refOK,
+		specified: p.specified, written: p.written,
+		writtenDone: p.writtenDone, procInst: p.procInst,
+	}
+}
+
+// needMoreInput rewinds to the start of the token that ran out of input
+// and restores the cursor from before the NextToken call. The decoder
+// read all the input written, so whatever looked like the token's end was
+// not, and feedReady resumes its search after it.
+func (p *Parser) needMoreInput(m *feedMark) (EventType, error) {
+	if err := p.restart(p.tokStart); err != nil {
+		p.err = err
+		return p.event, err
+	}
+	p.feed.scanTok = p.tokStart
+	p.feed.scanned = p.src.base + int64(len(p.src.buf)) + int64(len(p.feed.buf)-p.feed.r)
+
+	p.token, p.event, p.name, p.space = m.token, m.event, m.name, m.space
+	p.text, p.cdata, p.attrs, p.depth = m.text, m.cdata, m.attrs, m.depth
+	p.nsStack = p.nsStack[:m.nsLen]
+	p.baseStack = p.baseStack[:m.baseLen]
+	p.pendingPop, p.tokStart, p.refOK = m.pendingPop, m.tokStart, m.refOK
+	p.specified, p.written, p.writtenDone = m.specified, m.written, m.writtenDone
+	p.procInst = m.procInst
+	return p.event, ErrNeedMoreInput
+}
@@ -0,0 +1,128 @@
+package xpp_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	xpp "github.com/mmcdole/goxpp/v2"
+)
+
+func TestFeederByteAtATime(t *testing.T) {
+	doc := `<?xml version="1.0"?><feed xmlns:a="urn:a"><!-- c --><a:item id="1">one &amp; <![CDATA[two]]></a:item><empty/>tail</feed>`
+	want := strings.Join(collect(t, newParser(doc)), " ")
+
+	f := xpp.NewFeeder()
+	var got []string
+	needs := 0
+	for i := 0; ; {
+		tok, err := f.NextToken()
+		if errors.Is(err, xpp.ErrNeedMoreInput) {
+			needs++
+			if f.Err() != nil {
+				t.Fatalf("Err() = %v, want ErrNeedMoreInput not to poison", f.Err())
+			}
+			if i == len(doc) {
+				f.Close()
+				continue
+			}
+			f.Write([]byte{doc[i]})
+			i++
+			continue
+		}
+		if err != nil {
+			t.Fatalf("NextToken after %v: %v", got, err)
+		}
+		if tok == xpp.EndDocument {
+			break
+		}
+		switch tok {
+		case xpp.Text, xpp.CDSect:
+			got = append(got, "Text:"+f.Text())
+		default:
+			got = append(got, tok.String()+":"+f.Name())
+		}
+	}
+	if strings.Join(got, " ") != want {
+		t.Fatalf("tokens = %s\nwant     %s", strings.Join(got, " "), want)
+	}
+	if needs < len(doc) {
+		t.Fatalf("ErrNeedMoreInput returned %d times for %d writes", needs, len(doc))
+	}
+	if _, err := f.Write([]byte("x")); err == nil {
+		t.Fatal("Write after Close should fail")
+	}
+}
+
+func TestFeederKeepsCursor(t *testing.T) {
+	f := xpp.NewFeeder()
+	f.Write([]byte(`<a xmlns="urn:a"><b></b><c`))
+	advanceTo(t, f.Parser, "b")
+	if tok, err := f.NextToken(); err != nil || tok != xpp.EndTag {
+		t.Fatalf("NextToken = %s (%v), want EndTag", tok, err)
+	}
+	if _, err := f.NextToken(); !errors.Is(err, xpp.ErrNeedMoreInput) {
+		t.Fatalf("NextToken = %v, want ErrNeedMoreInput", err)
+	}
+	if f.Event() != xpp.EndTag || f.Name() != "b" || f.Depth() != 2 {
+		t.Fatalf("cursor = %s %s depth %d, want EndTag b depth 2", f.Event(), f.Name(), f.Depth())
+	}
+
+	f.Write([]byte(` x="1"/></a>`))
+	if tok, err := f.NextToken(); err != nil || tok != xpp.StartTag || f.Name() != "c" {
+		t.Fatalf("NextToken = %s %s (%v), want StartTag c", tok, f.Name(), err)
+	}
+	if f.Space() != "urn:a" || f.Attribute("x") != "1" || f.Depth() != 2 {
+		t.Fatalf("c: space %q x %q depth %d", f.Space(), f.Attribute("x"), f.Depth())
+	}
+	if offset := f.InputOffset(); offset != int64(len(`<a xmlns="urn:a"><b></b><c x="1"/>`)) {
+		t.Fatalf("InputOffset = %d, want the raw offset", offset)
+	}
+}
+
+func TestFeederTruncatedAtClose(t *testing.T) {
+	f := xpp.NewFeeder()
+	f.Write([]byte(`<a><b>`))
+	f.Close()
+	for {
+		tok, err := f.NextToken()
+		if err != nil {
+			if errors.Is(err, xpp.ErrNeedMoreInput) {
+				t.Fatal("ErrNeedMoreInput after Close")
+			}
+			return
+		}
+		if tok == xpp.EndDocument {
+			t.Fatal("truncated document should be a syntax error")
+		}
+	}
+}
+
+func BenchmarkFeederLargeText(b *testing.B) {
+	doc := []byte("<r>" + strings.Repeat("abcdefgh", 1<<19) + "</r>")
+	const chunk = 4 << 10
+	b.SetBytes(int64(len(doc)))
+	for i := 0; i < b.N; i++ {
+		f := xpp.NewFeeder()
+		off := 0
+		for {
+			tok, err := f.NextToken()
+			if errors.Is(err, xpp.ErrNeedMoreInput) {
+				if off == len(doc) {
+					f.Close()
+					continue
+				}
+				n := min(chunk, len(doc)-off)
+				f.Write(doc[off : off+n])
+				off += n
+				continue
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+			if tok == xpp.EndDocument {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package xpp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+// NewReader returns a parser that owns its input: it creates the decoder
+// over r itself, which lets it see the raw bytes behind each token. That
+// is what recovery and the other raw-input features build on; a parser
+// from New never has them.
+//
+// The decoder starts with encoding/xml's defaults. Configure it through
+// Decoder before the first advancement call. Raw offsets assume the
+// decoder reads the input directly, so a CharsetReader that converts the
+// input disables the raw-input features for the rest of the document.
+func NewReader(r io.Reader, opts ...Option) *Parser {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	src := &source{r: br}
+	p := New(xml.NewDecoder(src), opts...)
+	p.src = src
+	return p
+}
+
+// Decoder returns the decoder the parser reads from, for configuration
+// (Strict, AutoClose, Entity, CharsetReader). Reading tokens from it
+// directly desyncs the parser. A parser from NewReader may replace its
+// decoder while recovering; settings carry over to the replacement.
+func (p *Parser) Decoder() *xml.Decoder { return p.decoder }
+
+// source is the byte reader a parser from NewReader hands encoding/xml.
+// Because it implements io.ByteReader the decoder reads through it without
+// buffering of its own, so the bytes behind every token are retained here
+// and offsets line up with the decoder's InputOffset. It can also rewind to
+// a retained offset and serve synthetic bytes first, which is how a
+// replacement decoder is started mid-document.
+type source struct {
+	r io.ByteReader
+
+	buf  []byte // retained raw input starting at offset base
+	base int64
+	rd   int64 // offset of the next raw byte to hand out
+
+	// prefix is served before the raw input, to re-establish the open
+	// elements for a replacement decoder.
+	prefix []byte
+
+	// lines counts the newlines in discarded input, and lineStart is the
+	// offset of the line base is on, for line and column numbers.
+	lines     int
+	lineStart int64
+
+	// refSizes holds the replacement text sizes of the entities
+	// WithDTDEntities installed, and budget how much the document's
+	// references to them may still expand to. ref collects the name of a
+	// reference being read.
+	refSizes map[string]int
+	budget   int
+	maxRef   int
+	inRef    bool
+	ref      []byte
+}
+
+// contextKeep is how much input before the current token is retained, for
+// error excerpts.
+const contextKeep = 256
+
+func (s *source) ReadByte() (byte, error) {
+	if len(s.prefix) > 0 {
+		c := s.prefix[0]
+		s.prefix = s.prefix[1:]
+		return c, nil
+	}
+	if i := s.rd - s.base; i < int64(len(s.buf)) {
+		s.rd++
+		return s.buf[i], nil
+	}
+	c, err := s.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if s.refSizes != nil {
+		if err := s.countRef(c); err != nil {
+			return 0, err
+		}
+	}
+	s.buf = append(s.buf, c)
+	s.rd++
+	return c, nil
+}
+
+// countRefs starts charging references to the named entities, of the given
+// replacement text sizes, against budget. A nil sizes stops counting.
+func (s *source) countRefs(sizes map[string]int, budget int) {
+	s.refSizes, s.budget, s.inRef, s.maxRef = sizes, budget, false, 0
+	for name := range sizes {
+		s.maxRef = max(s.maxRef, len(name))
+	}
+}
+
+// countRef charges a reference ending at c, a byte of fresh input, against
+// the budget. Bytes are only counted when first read, so input replayed
+// into a replacement decoder is not charged again.
+func (s *source) countRef(c byte) error {
+	switch {
+	case c == '&':
+		s.inRef, s.ref = true, s.ref[:0]
+	case !s.inRef:
+	case c == ';':
+		s.inRef = false
+		n, ok := s.refSizes[string(s.ref)]
+		if !ok {
+			return nil
+		}
+		if s.budget -= n; s.budget < 0 {
+			return errEntityBudget
+		}
+	case len(s.ref) >= s.maxRef:
+		s.inRef = false
+	default:
+		s.ref = append(s.ref, c)
+	}
+	return nil
+}
+
+// Read satisfies io.Reader for xml.NewDecoder, which then reads through
+// ReadByte; it is never used for bulk reads.
+func (s *source) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	c, err := s.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	b[0] = c
+	return 1, nil
+}
+
+// release allows input before off to be discarded, keeping contextKeep
+// bytes. The copy is amortized: it only happens once the dead space
+// outweighs the live bytes.
+func (s *source) release(off int64) {
+	off -= contextKeep
+	dead := off - s.base
+	if dead <= 0 || dead < int64(len(s.buf))/2 || off > s.rd {
+		return
+	}
+	gone := s.buf[:dead]
+	s.lines += bytes.Count(gone, []byte{'\n'})
+	if i := bytes.LastIndexByte(gone, '\n'); i >= 0 {
+		s.lineStart = s.base + int64(i) + 1
+	}
+	n := copy(s.buf, s.buf[dead:])
+	s.buf = s.buf[:n]
+	s.base = off
+}
+
+// bytes returns the retained input in [from, to), clipped to what is
+// retained. The slice aliases the buffer; copy it to keep it.
+func (s *source) bytes(from, to int64) []byte {
+	from = max(from, s.base)
+	to = min(to, s.base+int64(len(s.buf)))
+	if from >= to {
+		return nil
+	}
+	return s.buf[from-s.base : to-s.base]
+}
+
+// rewind makes off the next raw byte to hand out, preceded by prefix. off
+// must not be before released input.
+func (s *source) rewind(off int64, prefix []byte) {
+	s.rd = max(off, s.base)
+	s.prefix = prefix
+}
+
+// indexFrom returns the offset of the first c at or after off, reading
+// more input as needed, or -1 if the input ends first. It does not move
+// the read position.
+func (s *source) indexFrom(off int64, c byte) int64 {
+	rd, prefix := s.rd, s.prefix
+	defer func() { s.rd, s.prefix = rd, prefix }()
+	s.rd, s.prefix = max(off, s.base), nil
+	for {
+		b, err := s.ReadByte()
+		if err != nil {
+			return -1
+		}
+		if b == c {
+			return s.rd - 1
+		}
+	}
+}
+
+// restart replaces the decoder with one reading from raw offset off. The
+// elements open at the cursor are replayed to it as synthetic start tags
+// carrying their namespace declarations, so it resolves prefixes and
+// matches end tags as the original would have.
+func (p *Parser) restart(off int64) error {
+	var prefix bytes.Buffer
+	for _, sc := range p.nsStack {
+		prefix.WriteByte('<')
+		prefix.WriteString(sc.qname)
+		for _, d := range sc.decls {
+			prefix.WriteString(" xmlns")
+			if d.prefix != "" {
+				prefix.WriteByte(':')
+				prefix.WriteString(d.prefix)
+			}
+			prefix.WriteString(`="`)
+			xml.EscapeText(&prefix, []byte(d.uri))
+			prefix.WriteByte('"')
+		}
+		prefix.WriteByte('>')
+	}
+
+	old := p.decoder
+	if old == nil {
+		return errors.New("xpp: cannot restart the decoder of a replayed parser")
+	}
+	p.src.rewind(off, prefix.Bytes())
+	d := xml.NewDecoder(p.src)
+	d.Strict = old.Strict
+	d.AutoClose = old.AutoClose
+	d.Entity = old.Entity
+	d.CharsetReader = old.CharsetReader
+	d.DefaultSpace = old.DefaultSpace
+	p.decoder = d
+	p.offsetAdj = off - int64(prefix.Len())
+
+	for range p.nsStack {
+		if _, err := d.Token(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rawName returns the qualified name of the start tag in raw.
+func rawName(raw []byte) string {
+	if len(raw) == 0 || raw[0] != '<' {
+		return ""
+	}
+	raw = raw[1:]
+	end := bytes.IndexAny(raw, " \t\r\n/>")
+	if end < 0 {
+		end = len(raw)
+	}
+	return string(raw[:end])
+}
+
+// splitAttrs returns the attribute names and value literals of a raw
+// start tag, as written. It reports false for a tag it cannot split, such
+// as one with an attribute written without a quoted value, which the
+// non-strict decoder accepts.
+func splitAttrs(raw []byte) (names, literals []string, ok bool) {
+	if len(raw) == 0 || raw[0] != '<' {
+		return nil, nil, false
+	}
+	i := bytes.IndexAny(raw, " \t\r\n/>")
+	if i < 0 {
+		return nil, nil, false
+	}
+	skipSpace := func() {
+		for i < len(raw) && isSpaceByte(raw[i]) {
+			i++
+		}
+	}
+	for {
+		skipSpace()
+		if i >= len(raw) {
+			return nil, nil, false
+		}
+		if raw[i] == '/' || raw[i] == '>' {
+			return names, literals, true
+		}
+		start := i
+		for i < len(raw) && !isSpaceByte(raw[i]) && raw[i] != '=' && raw[i] != '/' && raw[i] != '>' {
+			i++
+		}
+		name := string(raw[start:i])
+		skipSpace()
+		if i >= len(raw) || raw[i] != '=' {
+			return nil, nil, false
+		}
+		i++
+		skipSpace()
+		if i >= len(raw) || (raw[i] != '"' && raw[i] != '\'') {
+			return nil, nil, false
+		}
+		end := bytes.IndexByte(raw[i+1:], raw[i])
+		if end < 0 {
+			return nil, nil, false
+		}
+		names = append(names, name)
+		literals = append(literals, string(raw[i+1:i+1+end]))
+		i += end + 2
+	}
+}
+
+// pos returns the line and byte column of offset off, counting from 1.
+// off is clipped to the retained input.
+func (s *source) pos(off int64) (line, col int) {
+	off = min(max(off, s.base), s.base+int64(len(s.buf)))
+	b := s.bytes(s.base, off)
+	line = s.lines + bytes.Count(b, []byte{'\n'}) + 1
+	start := s.lineStart
+	if i := bytes.LastIndexByte(b, '\n'); i >= 0 {
+		start = s.base + int64(i) + 1
+	}
+	return line, int(off-start) + 1
+}
+
+// excerptWidth is how much input excerpt shows on either side of the
+// offset.
+const excerptWidth = 40
+
+// excerpt returns the retained line around off, clipped to excerptWidth
+// bytes either side, and off's index in it. It never reads more input.
+func (s *source) excerpt(off int64) (string, int) {
+	b := s.bytes(off-excerptWidth, off)
+	if i := bytes.LastIndexByte(b, '\n'); i >= 0 {
+		b = b[i+1:]
+	}
+	after := s.bytes(off, off+excerptWidth)
+	if i := bytes.IndexAny(after, "\r\n"); i >= 0 {
+		after = after[:i]
+	}
+	before := strings.TrimSuffix(string(b), "\r")
+	return before + string(after), len(before)
+}
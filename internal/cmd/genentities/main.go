@@ -0,0 +1,129 @@
+// Command genentities writes the HTML5 named character reference table
+// used by xpp.HTMLEntities. It reads the table maintained in the Go
+// distribution's html package, so the output tracks the toolchain's copy
+// of the WHATWG list.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	out := flag.String("o", "htmlentities.go", "output file")
+	flag.Parse()
+
+	goroot, err := exec.Command("go", "env", "GOROOT").Output()
+	if err != nil {
+		log.Fatal(err)
+	}
+	src := filepath.Join(strings.TrimSpace(string(goroot)), "src", "html", "entity.go")
+
+	table, err := load(src)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	names := make([]string, 0, len(table))
+	for name := range table {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by internal/cmd/genentities; DO NOT EDIT.\n\n")
+	buf.WriteString("package xpp\n\n")
+	buf.WriteString("var htmlEntities = map[string]string{\n")
+	for _, name := range names {
+		fmt.Fprintf(&buf, "\t%q: %+q,\n", name, table[name])
+	}
+	buf.WriteString("}\n")
+
+	formatted, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*out, formatted, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// load collects the semicolon-terminated entries of the entity and entity2
+// map literals in src, keyed without the semicolon as encoding/xml's
+// Decoder.Entity expects. The legacy forms without a semicolon are not
+// references in XML and are dropped.
+func load(src string) (map[string]string, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), src, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	table := map[string]string{}
+	var walkErr error
+	ast.Inspect(f, func(n ast.Node) bool {
+		kv, ok := n.(*ast.KeyValueExpr)
+		if !ok || walkErr != nil {
+			return walkErr == nil
+		}
+		key, ok := kv.Key.(*ast.BasicLit)
+		if !ok || key.Kind != token.STRING {
+			return true
+		}
+		name, err := strconv.Unquote(key.Value)
+		if err != nil || !strings.HasSuffix(name, ";") {
+			return true
+		}
+		var value []rune
+		switch v := kv.Value.(type) {
+		case *ast.BasicLit:
+			value, walkErr = runes(v)
+		case *ast.CompositeLit:
+			for _, elt := range v.Elts {
+				lit, ok := elt.(*ast.BasicLit)
+				if !ok {
+					walkErr = fmt.Errorf("unexpected value for %s", name)
+					return false
+				}
+				r, err := runes(lit)
+				if err != nil {
+					walkErr = err
+					return false
+				}
+				value = append(value, r...)
+			}
+		default:
+			return true
+		}
+		table[strings.TrimSuffix(name, ";")] = string(value)
+		return true
+	})
+	if walkErr != nil {
+		return nil, walkErr
+	}
+	if len(table) < 2000 {
+		return nil, fmt.Errorf("%s: found only %d entities; has the file's layout changed?", src, len(table))
+	}
+	return table, nil
+}
+
+func runes(lit *ast.BasicLit) ([]rune, error) {
+	if lit.Kind != token.CHAR {
+		return nil, fmt.Errorf("unexpected literal %s", lit.Value)
+	}
+	s, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return nil, err
+	}
+	return []rune(s), nil
+}
@@ -0,0 +1,99 @@
+package xpp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+)
+
+// WithMultiDocument reads the input as a stream of back-to-back documents,
+// as sent by log shippers and socket protocols. The parser reports
+// EndDocument as soon as each root element closes, without reading
+// further, and NextDocument continues with the next document on the same
+// input. Comments and processing instructions after a root element are
+// reported as part of the following document.
+func WithMultiDocument() Option {
+	return func(p *Parser) { p.multiDoc = true }
+}
+
+// NextDocument starts the next document in a WithMultiDocument stream once
+// the current one has ended. The parser is reset to StartDocument with no
+// open elements, namespace or base scopes, DOCTYPE or XML declaration;
+// entities installed by WithDTDEntities are removed. Whitespace between
+// documents is skipped. It returns io.EOF when the input has no further
+// document.
+func (p *Parser) NextDocument() error {
+	if p.err != nil {
+		return p.err
+	}
+	if !p.multiDoc {
+		return errors.New("xpp: NextDocument requires WithMultiDocument")
+	}
+	if !p.docEnded {
+		return errors.New("xpp: NextDocument called before the end of the document")
+	}
+	if p.inputEnded {
+		return io.EOF
+	}
+	if p.tape != nil {
+		// The tape holds the next document's events right after the
+		// EndDocument just replayed.
+		if !p.tape.More() {
+			p.inputEnded = true
+			return io.EOF
+		}
+		p.resetDocument()
+		return nil
+	}
+
+	for p.pending == nil {
+		start := p.InputOffset()
+		tok, err := p.decoder.Token()
+		if err == io.EOF {
+			p.inputEnded = true
+			return io.EOF
+		}
+		if cd, ok := tok.(xml.CharData); ok && err == nil && len(bytes.TrimSpace(cd)) == 0 {
+			continue
+		}
+		// Hand the token, or the error, to NextToken, so recovery and
+		// error reporting treat it like any other.
+		p.pending = &pendingToken{tok: xml.CopyToken(tok), err: err, start: start}
+	}
+
+	p.resetDocument()
+	return nil
+}
+
+// resetDocument returns the parser to StartDocument with no document
+// state.
+func (p *Parser) resetDocument() {
+	p.applyPendingPop()
+	p.depth = 0
+	p.nsStack = nil
+	p.baseStack = nil
+	p.doctype = nil
+	p.xmlDecl = nil
+	p.attrDefaults = nil
+	if p.entityBase != nil {
+		p.decoder.Entity = p.entityBase
+		p.entityBase = nil
+	}
+	if p.src != nil {
+		p.src.countRefs(nil, 0)
+	}
+	p.budgeted = false
+	p.resetTokenState()
+	p.token = nil
+	p.queue = nil
+	p.event = StartDocument
+	p.docEnded = false
+}
+
+// pendingToken is a decoder result read ahead by NextDocument.
+type pendingToken struct {
+	tok   xml.Token
+	err   error
+	start int64
+}
@@ -0,0 +1,84 @@
+package xpp_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	xpp "github.com/mmcdole/goxpp/v2"
+)
+
+func TestMultiDocumentStream(t *testing.T) {
+	doc := `<?xml version="1.0"?><log xmlns="urn:a"><e>1</e></log>
+<?xml version="1.0"?>
+<log><e>2</e></log>  <log/>
+`
+	p := xpp.NewReader(strings.NewReader(doc), xpp.WithMultiDocument())
+
+	var docs []string
+	for {
+		got := strings.Join(collect(t, p), " ")
+		docs = append(docs, got)
+		if p.Depth() != 0 {
+			t.Fatalf("Depth at EndDocument = %d", p.Depth())
+		}
+		if _, err := p.NextToken(); err != io.EOF {
+			t.Fatalf("NextToken after EndDocument = %v, want io.EOF", err)
+		}
+		err := p.NextDocument()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Event() != xpp.StartDocument || p.XMLDecl() != nil {
+			t.Fatalf("after NextDocument: event %s, XMLDecl %+v", p.Event(), p.XMLDecl())
+		}
+	}
+
+	want := []string{
+		"ProcessingInstruction: StartTag:log StartTag:e Text:1 EndTag:e EndTag:log",
+		"ProcessingInstruction: Text:\n StartTag:log StartTag:e Text:2 EndTag:e EndTag:log",
+		"StartTag:log EndTag:log",
+	}
+	if strings.Join(docs, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("documents =\n%s\nwant\n%s", strings.Join(docs, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestMultiDocumentResetsScopes(t *testing.T) {
+	doc := `<!DOCTYPE a [<!ENTITY x "ex">]><a xmlns="urn:a" xml:base="http://a.example/">&x;</a><b>&x;</b>`
+	p := xpp.NewReader(strings.NewReader(doc), xpp.WithMultiDocument(), xpp.WithDTDEntities(0), xpp.WithRecovery())
+	advanceTo(t, p, "a")
+	if text, err := p.NextText(); err != nil || text != "ex" {
+		t.Fatalf("NextText = %q (%v)", text, err)
+	}
+	if tok, err := p.Next(); err != nil || tok != xpp.EndDocument {
+		t.Fatalf("Next = %s (%v), want EndDocument", tok, err)
+	}
+	if err := p.NextDocument(); err != nil {
+		t.Fatal(err)
+	}
+
+	advanceTo(t, p, "b")
+	if p.Space() != "" || p.BaseURL() != nil || p.DocType() != nil {
+		t.Fatalf("second document: space %q base %v doctype %+v, want fresh scopes", p.Space(), p.BaseURL(), p.DocType())
+	}
+	// The entity belonged to the first document's DTD.
+	if _, err := p.NextText(); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Errors()) != 1 {
+		t.Fatalf("Errors() = %v, want the now undeclared entity", p.Errors())
+	}
+}
+
+func TestNextDocumentRequiresMode(t *testing.T) {
+	p := newParser(`<a/>`)
+	collect(t, p)
+	if err := p.NextDocument(); err == nil || errors.Is(err, io.EOF) {
+		t.Fatalf("NextDocument = %v, want a usage error", err)
+	}
+}
@@ -0,0 +1,76 @@
+package xpp
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ParseError is a syntax error from the decoder with its location. It
+// wraps the *xml.SyntaxError, which errors.As still finds; the Line in
+// that error is the decoder's, which after a restart does not count from
+// the start of the input, while Line here always does.
+type ParseError struct {
+	Err error
+
+	// Offset is the raw input offset where the decoder stopped; Line and
+	// Column locate it, counting from 1, with Column in bytes.
+	Offset       int64
+	Line, Column int
+	// Path is the slash-separated path of the elements open at the error,
+	// as in ExpectError.
+	Path string
+	// Excerpt is the offending line of input, clipped around Offset, with
+	// a second line holding a caret under Offset. It ends where the
+	// decoder stopped reading, as no more input is read to report an
+	// error. It is only available from NewReader parsers.
+	Excerpt string
+}
+
+func (e *ParseError) Error() string {
+	// The decoder's own line number is left out, as it can disagree.
+	detail := e.Err.Error()
+	var serr *xml.SyntaxError
+	if errors.As(e.Err, &serr) {
+		detail = "syntax error: " + serr.Msg
+	}
+	msg := fmt.Sprintf("xpp: %s at line %d, column %d (offset %d)", detail, e.Line, e.Column, e.Offset)
+	if e.Path != "" {
+		msg += " in " + e.Path
+	}
+	return msg
+}
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// parseError locates a syntax error from the decoder. Other errors, such
+// as the reader's, are returned as is.
+func (p *Parser) parseError(err error) error {
+	var serr *xml.SyntaxError
+	if !errors.As(err, &serr) {
+		return err
+	}
+	e := &ParseError{Err: err, Offset: p.InputOffset(), Path: p.path()}
+	e.Line, e.Column = p.position(e.Offset)
+	if p.src != nil {
+		line, at := p.src.excerpt(e.Offset)
+		e.Excerpt = line + "\n" + caret(line[:at])
+	}
+	return e
+}
+
+// caret returns a line that puts a caret under the end of before, copying
+// its tabs so the caret lines up however tabs are displayed.
+func caret(before string) string {
+	var sb strings.Builder
+	for _, r := range before {
+		if r == '\t' {
+			sb.WriteByte('\t')
+		} else {
+			sb.WriteByte(' ')
+		}
+	}
+	sb.WriteByte('^')
+	return sb.String()
+}
@@ -0,0 +1,69 @@
+package xpp_test
+
+import (
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+
+	xpp "github.com/mmcdole/goxpp/v2"
+)
+
+func TestParseError(t *testing.T) {
+	doc := "<feed>\n\t<item>\n\t\t<title>a &bogus; b</title>\n\t</item>\n</feed>"
+	p := xpp.NewReader(strings.NewReader(doc))
+	advanceTo(t, p, "title")
+	if _, err := p.NextToken(); err == nil {
+		t.Fatal("strict decoder should reject the undeclared entity")
+	}
+
+	var perr *xpp.ParseError
+	if !errors.As(p.Err(), &perr) {
+		t.Fatalf("Err() = %v, want *ParseError", p.Err())
+	}
+	var serr *xml.SyntaxError
+	if !errors.As(p.Err(), &serr) {
+		t.Fatalf("Err() = %v does not unwrap to *xml.SyntaxError", p.Err())
+	}
+	if perr.Line != 3 || perr.Path != "/feed/item/title" {
+		t.Fatalf("ParseError = %+v", perr)
+	}
+	if perr.Offset != int64(strings.Index(doc, " b</title>")) || perr.Column != 19 {
+		t.Fatalf("offset %d column %d, want after the reference", perr.Offset, perr.Column)
+	}
+	// The excerpt ends where the decoder stopped reading.
+	want := "\t\t<title>a &bogus;\n\t\t                ^"
+	if perr.Excerpt != want {
+		t.Fatalf("Excerpt =\n%s\nwant\n%s", perr.Excerpt, want)
+	}
+	if msg := perr.Error(); !strings.Contains(msg, "line 3, column 19") || !strings.Contains(msg, "bogus") {
+		t.Fatalf("Error() = %q", msg)
+	}
+}
+
+func TestParseErrorWithoutRawInput(t *testing.T) {
+	p := xpp.New(xml.NewDecoder(strings.NewReader("<a>\n<b></c></a>")))
+	for {
+		if _, err := p.NextToken(); err != nil {
+			break
+		}
+	}
+	var perr *xpp.ParseError
+	if !errors.As(p.Err(), &perr) {
+		t.Fatalf("Err() = %v, want *ParseError", p.Err())
+	}
+	if perr.Line != 2 || perr.Path != "/a/b" || perr.Excerpt != "" {
+		t.Fatalf("ParseError = %+v", perr)
+	}
+}
+
+func TestDecodeElementParseError(t *testing.T) {
+	p := xpp.NewReader(strings.NewReader(`<r><v>1 &x; 2</v></r>`))
+	advanceTo(t, p, "v")
+	var v string
+	err := p.DecodeElement(&v)
+	var perr *xpp.ParseError
+	if !errors.As(err, &perr) || !errors.As(p.Err(), &perr) {
+		t.Fatalf("DecodeElement = %v, Err() = %v, want *ParseError", err, p.Err())
+	}
+}
@@ -0,0 +1,148 @@
+package xpp
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// ProcInst is a processing instruction. Inst is the instruction as
+// written, without the whitespace that separates it from Target.
+type ProcInst struct {
+	Target string
+	Inst   string
+}
+
+// PseudoAttrs parses Inst as the pseudo-attributes used by the XML
+// declaration and instructions such as xml-stylesheet: name="value" pairs
+// in single or double quotes, separated by whitespace. Character
+// references and the predefined entities in values are expanded. On a
+// syntax error it returns the pairs before it along with the error.
+func (pi *ProcInst) PseudoAttrs() ([]xml.Attr, error) {
+	var attrs []xml.Attr
+	s := pi.Inst
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		if s == "" {
+			return attrs, nil
+		}
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return attrs, pi.syntaxErr("expected name=\"value\"")
+		}
+		name := strings.TrimRight(s[:eq], " \t\r\n")
+		if !isName(name) {
+			return attrs, pi.syntaxErr(fmt.Sprintf("invalid name %q", name))
+		}
+		s = strings.TrimLeft(s[eq+1:], " \t\r\n")
+		if s == "" || (s[0] != '"' && s[0] != '\'') {
+			return attrs, pi.syntaxErr(fmt.Sprintf("unquoted value for %s", name))
+		}
+		end := strings.IndexByte(s[1:], s[0])
+		if end < 0 {
+			return attrs, pi.syntaxErr(fmt.Sprintf("unterminated value for %s", name))
+		}
+		value, ok := expandPseudoValue(s[1 : end+1])
+		if !ok {
+			return attrs, pi.syntaxErr(fmt.Sprintf("invalid reference in value of %s", name))
+		}
+		attrs = append(attrs, xml.Attr{Name: xml.Name{Local: name}, Value: value})
+		s = s[end+2:]
+		if s != "" && !isSpaceByte(s[0]) {
+			return attrs, pi.syntaxErr("missing whitespace between pseudo-attributes")
+		}
+	}
+}
+
+// PseudoAttr returns the value of the named pseudo-attribute, or false
+// when it is absent or Inst is not in pseudo-attribute form.
+func (pi *ProcInst) PseudoAttr(name string) (string, bool) {
+	attrs, err := pi.PseudoAttrs()
+	if err != nil {
+		return "", false
+	}
+	for _, a := range attrs {
+		if a.Name.Local == name {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+func (pi *ProcInst) syntaxErr(msg string) error {
+	return fmt.Errorf("xpp: <?%s?> pseudo-attributes: %s", pi.Target, msg)
+}
+
+func expandPseudoValue(v string) (string, bool) {
+	if strings.IndexByte(v, '&') < 0 {
+		return v, true
+	}
+	var sb strings.Builder
+	for i := 0; i < len(v); i++ {
+		if v[i] != '&' {
+			sb.WriteByte(v[i])
+			continue
+		}
+		semi := strings.IndexByte(v[i:], ';')
+		if semi < 0 {
+			return "", false
+		}
+		ref := v[i+1 : i+semi]
+		i += semi
+		if text, ok := predefinedEntities[ref]; ok {
+			sb.WriteString(text)
+			continue
+		}
+		num, ok := strings.CutPrefix(ref, "#")
+		if !ok {
+			return "", false
+		}
+		r, ok := charRef(num)
+		if !ok {
+			return "", false
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String(), true
+}
+
+// XMLDecl is the XML declaration, <?xml version="1.0" ...?>. Encoding and
+// Standalone are "" when the declaration omits them; Standalone is
+// otherwise "yes" or "no" as written.
+type XMLDecl struct {
+	Version    string
+	Encoding   string
+	Standalone string
+}
+
+// ProcInst returns the current processing instruction, or nil when the
+// cursor is not on a ProcessingInstruction.
+func (p *Parser) ProcInst() *ProcInst {
+	if p.event != ProcessingInstruction {
+		return nil
+	}
+	return p.procInst
+}
+
+// XMLDecl returns the document's XML declaration, or nil before one has
+// been read or when the document has none. The declaration is still
+// reported as a ProcessingInstruction with target "xml". A declaration
+// whose pseudo-attributes cannot be parsed is recorded with only the
+// fields that were recognized before the error.
+func (p *Parser) XMLDecl() *XMLDecl { return p.xmlDecl }
+
+func (p *Parser) processXMLDecl(pi *ProcInst) {
+	decl := &XMLDecl{}
+	attrs, _ := pi.PseudoAttrs()
+	for _, a := range attrs {
+		switch a.Name.Local {
+		case "version":
+			decl.Version = a.Value
+		case "encoding":
+			decl.Encoding = a.Value
+		case "standalone":
+			decl.Standalone = a.Value
+		}
+	}
+	p.xmlDecl = decl
+}
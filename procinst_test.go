@@ -0,0 +1,73 @@
+package xpp_test
+
+import (
+	"testing"
+
+	xpp "github.com/mmcdole/goxpp/v2"
+)
+
+func TestXMLDecl(t *testing.T) {
+	p := newParser(`<?xml version="1.0" encoding='utf-8' standalone="yes"?><r/>`)
+	if p.XMLDecl() != nil {
+		t.Fatal("XMLDecl before the declaration should be nil")
+	}
+	tok, err := p.NextToken()
+	if err != nil || tok != xpp.ProcessingInstruction {
+		t.Fatalf("NextToken = %s (%v), want ProcessingInstruction", tok, err)
+	}
+	want := xpp.XMLDecl{Version: "1.0", Encoding: "utf-8", Standalone: "yes"}
+	if decl := p.XMLDecl(); decl == nil || *decl != want {
+		t.Fatalf("XMLDecl = %+v, want %+v", decl, want)
+	}
+
+	advanceTo(t, p, "r")
+	if p.XMLDecl() == nil {
+		t.Fatal("XMLDecl should persist past the declaration")
+	}
+	if p.ProcInst() != nil {
+		t.Fatal("ProcInst should be nil off a processing instruction")
+	}
+}
+
+func TestXMLDeclAbsent(t *testing.T) {
+	p := newParser(`<r/>`)
+	advanceTo(t, p, "r")
+	if p.XMLDecl() != nil {
+		t.Fatalf("XMLDecl = %+v, want nil", p.XMLDecl())
+	}
+}
+
+func TestProcInstPseudoAttrs(t *testing.T) {
+	p := newParser(`<?xml-stylesheet href="style.xsl?a=1&amp;b=2" type = 'text/xsl'?><?php echo 1; ?><r/>`)
+	if _, err := p.NextToken(); err != nil {
+		t.Fatal(err)
+	}
+	pi := p.ProcInst()
+	if pi == nil || pi.Target != "xml-stylesheet" {
+		t.Fatalf("ProcInst = %+v", pi)
+	}
+	attrs, err := pi.PseudoAttrs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attrs) != 2 || attrs[0].Value != "style.xsl?a=1&b=2" || attrs[1].Name.Local != "type" {
+		t.Fatalf("PseudoAttrs = %+v", attrs)
+	}
+	if v, ok := pi.PseudoAttr("type"); !ok || v != "text/xsl" {
+		t.Fatalf("PseudoAttr(type) = %q %v", v, ok)
+	}
+
+	if _, err := p.NextToken(); err != nil {
+		t.Fatal(err)
+	}
+	pi = p.ProcInst()
+	if pi.Target != "php" || pi.Inst != "echo 1; " {
+		t.Fatalf("ProcInst = %+v, want target and instruction split", pi)
+	}
+	if _, err := pi.PseudoAttrs(); err == nil {
+		t.Fatal("PseudoAttrs should reject free-form instructions")
+	}
+	if p.Text() != "php echo 1; " {
+		t.Fatalf("Text = %q, want the formatted instruction unchanged", p.Text())
+	}
+}
@@ -0,0 +1,52 @@
+package xpp
+
+import "fmt"
+
+// RecoveredError records a syntax error the parser recovered from. The
+// input in [Start, End) was discarded: Start is the offset of the token
+// the error occurred in and End is where parsing resumed. Err is a
+// syntax error as a *ParseError.
+type RecoveredError struct {
+	Err        error
+	Start, End int64
+}
+
+func (e *RecoveredError) Error() string {
+	return fmt.Sprintf("xpp: recovered from %v; skipped input at offsets %d-%d", e.Err, e.Start, e.End)
+}
+
+func (e *RecoveredError) Unwrap() error { return e.Err }
+
+// WithRecovery makes a parser from NewReader recover from syntax errors
+// instead of poisoning itself. On an error it discards input up to the
+// next '<' after the failing token and continues there with the same
+// elements open; each error is recorded in Errors. If no '<' follows, the
+// document ends. Errors from DecodeElement still poison the parser. A
+// parser from New ignores this option, as it cannot see the raw input.
+func WithRecovery() Option {
+	return func(p *Parser) { p.recover = true }
+}
+
+// Errors returns the syntax errors recovered from so far, in input order.
+// It is always empty without WithRecovery.
+func (p *Parser) Errors() []*RecoveredError { return p.recovered }
+
+// recoverFrom handles decoder error err in the token starting at start.
+// It reports false when the input has no further markup.
+func (p *Parser) recoverFrom(start int64, err error) (bool, error) {
+	// Resume strictly after the failing token's first byte, so every
+	// recovery makes progress.
+	resume := p.src.indexFrom(start+1, '<')
+	rec := &RecoveredError{Err: p.parseError(err), Start: start, End: resume}
+	if resume < 0 {
+		rec.End = p.src.base + int64(len(p.src.buf))
+	}
+	p.recovered = append(p.recovered, rec)
+	if resume < 0 {
+		return false, nil
+	}
+	if err := p.restart(resume); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,155 @@
+package xpp_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+
+	xpp "github.com/mmcdole/goxpp/v2"
+)
+
+// collect returns "event:name" (or "Text:text") for every token up to the
+// end of the document.
+func collect(t *testing.T, p *xpp.Parser) []string {
+	t.Helper()
+	var out []string
+	for {
+		tok, err := p.NextToken()
+		if err != nil {
+			t.Fatalf("NextToken after %v: %v", out, err)
+		}
+		switch tok {
+		case xpp.EndDocument:
+			return out
+		case xpp.Text:
+			out = append(out, "Text:"+p.Text())
+		case xpp.EntityRef:
+			out = append(out, "EntityRef:"+p.Name())
+		default:
+			out = append(out, tok.String()+":"+p.Name())
+		}
+	}
+}
+
+func TestRecoveryResumesAtNextMarkup(t *testing.T) {
+	doc := `<feed><item>a &bogus; b</item><item>good</item></feed>`
+	p := xpp.NewReader(strings.NewReader(doc), xpp.WithRecovery())
+
+	got := strings.Join(collect(t, p), " ")
+	want := "StartTag:feed StartTag:item EndTag:item StartTag:item Text:good EndTag:item EndTag:feed"
+	if got != want {
+		t.Fatalf("tokens = %s\nwant     %s", got, want)
+	}
+	if p.Err() != nil {
+		t.Fatalf("Err() = %v, want nil in recovery mode", p.Err())
+	}
+
+	errs := p.Errors()
+	if len(errs) != 1 {
+		t.Fatalf("Errors() = %v, want one", errs)
+	}
+	rec := errs[0]
+	if rec.Start != int64(strings.Index(doc, "a &bogus")) || rec.End != int64(strings.Index(doc, "</item>")) {
+		t.Fatalf("region = %d-%d, want the damaged text", rec.Start, rec.End)
+	}
+	var serr *xml.SyntaxError
+	if !errors.As(rec, &serr) {
+		t.Fatalf("recovered error %v does not unwrap to *xml.SyntaxError", rec)
+	}
+}
+
+func TestRecoveryKeepsNamespaceScope(t *testing.T) {
+	doc := `<f xmlns:a="urn:a" xmlns="urn:d"><a:x>bad &z;</a:x><a:y>ok</a:y><plain/></f>`
+	p := xpp.NewReader(strings.NewReader(doc), xpp.WithRecovery())
+
+	advanceTo(t, p, "y")
+	if p.Space() != "urn:a" || p.Depth() != 2 {
+		t.Fatalf("after recovery: space %q depth %d, want urn:a 2", p.Space(), p.Depth())
+	}
+	if prefix, ok := p.PrefixForURI("urn:a"); !ok || prefix != "a" {
+		t.Fatalf("PrefixForURI = %q %v, want a true", prefix, ok)
+	}
+	advanceTo(t, p, "plain")
+	if p.Space() != "urn:d" {
+		t.Fatalf("default namespace after recovery = %q, want urn:d", p.Space())
+	}
+	if offset := p.InputOffset(); offset != int64(strings.Index(doc, "</f>")) {
+		t.Fatalf("InputOffset = %d, want raw input offset %d", offset, strings.Index(doc, "</f>"))
+	}
+}
+
+func TestRecoveryMismatchedEndTag(t *testing.T) {
+	doc := `<a><b></c><d/></b></a>`
+	p := xpp.NewReader(strings.NewReader(doc), xpp.WithRecovery())
+
+	got := strings.Join(collect(t, p), " ")
+	want := "StartTag:a StartTag:b StartTag:d EndTag:d EndTag:b EndTag:a"
+	if got != want {
+		t.Fatalf("tokens = %s\nwant     %s", got, want)
+	}
+	if len(p.Errors()) != 1 {
+		t.Fatalf("Errors() = %v, want one", p.Errors())
+	}
+}
+
+func TestRecoveryTruncatedDocumentEnds(t *testing.T) {
+	p := xpp.NewReader(strings.NewReader(`<root><item>text`), xpp.WithRecovery())
+
+	got := strings.Join(collect(t, p), " ")
+	if got != "StartTag:root StartTag:item Text:text" {
+		t.Fatalf("tokens = %s", got)
+	}
+	if len(p.Errors()) != 1 {
+		t.Fatalf("Errors() = %v, want the truncation", p.Errors())
+	}
+}
+
+func TestRecoveryRequiresOwnedInput(t *testing.T) {
+	d := xml.NewDecoder(bytes.NewReader([]byte(`<root>&bogus;</root>`)))
+	p := xpp.New(d, xpp.WithRecovery())
+	for i := 0; i < 5; i++ {
+		if _, err := p.NextToken(); err != nil {
+			if len(p.Errors()) != 0 {
+				t.Fatalf("Errors() = %v, want none from a parser built with New", p.Errors())
+			}
+			return
+		}
+	}
+	t.Fatal("parser built with New should still poison on a syntax error")
+}
+
+func TestNewReaderWithoutRecoveryPoisons(t *testing.T) {
+	p := xpp.NewReader(strings.NewReader(`<root>&bogus;</root>`))
+	advanceTo(t, p, "root")
+	if _, err := p.NextToken(); err == nil {
+		t.Fatal("strict decoder should reject the undeclared entity")
+	}
+	if p.Err() == nil {
+		t.Fatal("Err() should be sticky without WithRecovery")
+	}
+}
+
+func TestRecoveryAfterLongInput(t *testing.T) {
+	// Enough input before the error that the retained buffer has been
+	// compacted several times.
+	var sb strings.Builder
+	sb.WriteString("<feed>")
+	for i := 0; i < 2000; i++ {
+		sb.WriteString("<item>some item text</item>")
+	}
+	sb.WriteString("<item>&bogus;</item><last>ok</last></feed>")
+	doc := sb.String()
+
+	p := xpp.NewReader(strings.NewReader(doc), xpp.WithRecovery())
+	advanceTo(t, p, "last")
+	text, err := p.NextText()
+	if err != nil || text != "ok" {
+		t.Fatalf("NextText = %q (%v), want ok", text, err)
+	}
+	errs := p.Errors()
+	if len(errs) != 1 || errs[0].Start != int64(strings.Index(doc, "&bogus;")) {
+		t.Fatalf("Errors() = %v, want one at the bad entity", errs)
+	}
+}
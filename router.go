@@ -0,0 +1,121 @@
+package xpp
+
+import "strings"
+
+// HandlerFunc handles one child element. It is called with the parser on
+// the child's StartTag and must leave the parser on the child's matching
+// EndTag, as NextText, Skip and DecodeElement do.
+type HandlerFunc func(p *Parser) error
+
+// Router dispatches the children of an element to handlers registered by
+// namespace and local name. Matching follows ExpectAll: case-insensitive,
+// with "*" matching anything. When several routes match, the most specific
+// one wins (an exact space and name beats a wildcard name, which beats a
+// wildcard space, which beats "*", "*"). The zero value is an empty router
+// ready to use.
+type Router struct {
+	routes []route
+}
+
+type route struct {
+	space, name string
+	h           HandlerFunc
+}
+
+// specificity ranks a route for choosing among matches. A wildcard space
+// with an exact name outranks an exact space with a wildcard name: feeds
+// routinely put a known element in an unexpected namespace.
+func (r route) specificity() int {
+	switch {
+	case r.space != "*" && r.name != "*":
+		return 3
+	case r.name != "*":
+		return 2
+	case r.space != "*":
+		return 1
+	}
+	return 0
+}
+
+func (r route) matches(space, name string) bool {
+	return (r.space == "*" || strings.EqualFold(r.space, space)) &&
+		(r.name == "*" || strings.EqualFold(r.name, name))
+}
+
+// NewRouter returns an empty router.
+func NewRouter() *Router { return &Router{} }
+
+// Handle registers h for child elements with the given local name in any
+// namespace. It is HandleAll with a "*" space.
+func (r *Router) Handle(name string, h HandlerFunc) {
+	r.HandleAll("*", name, h)
+}
+
+// HandleAll registers h for child elements with the given namespace and
+// local name. Registering the same pair again (compared case-insensitively)
+// replaces the earlier handler.
+func (r *Router) HandleAll(space, name string, h HandlerFunc) {
+	for i := range r.routes {
+		if strings.EqualFold(r.routes[i].space, space) && strings.EqualFold(r.routes[i].name, name) {
+			r.routes[i].h = h
+			return
+		}
+	}
+	r.routes = append(r.routes, route{space: space, name: name, h: h})
+}
+
+// Lookup returns the handler Children would dispatch an element with the
+// given namespace and local name to, or nil when no route matches. Among
+// equally specific matches the earliest registered wins.
+func (r *Router) Lookup(space, name string) HandlerFunc {
+	best, bestRank := -1, -1
+	for i, rt := range r.routes {
+		if !rt.matches(space, name) {
+			continue
+		}
+		if rank := rt.specificity(); rank > bestRank {
+			best, bestRank = i, rank
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+	return r.routes[best].h
+}
+
+// Children requires the parser to be on a StartTag and iterates the
+// element's children, calling the matching handler for each child
+// StartTag and skipping children without one. Whitespace text between
+// children is ignored; other text is an error, as in NextTag. A handler
+// that returns without leaving the parser on the child's EndTag is
+// reported as an *ExpectError. On success the parser is left on the
+// element's matching EndTag.
+func (r *Router) Children(p *Parser) error {
+	if p.event != StartTag {
+		return p.expectErr(StartTag, "*", "*")
+	}
+	for {
+		t, err := p.NextTag()
+		if err != nil {
+			return err
+		}
+		if t == EndTag {
+			return nil
+		}
+
+		space, name, depth := p.space, p.name, p.depth
+		h := r.Lookup(space, name)
+		if h == nil {
+			if err := p.Skip(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := h(p); err != nil {
+			return err
+		}
+		if p.event != EndTag || p.depth != depth || p.name != name || p.space != space {
+			return p.expectErr(EndTag, space, name)
+		}
+	}
+}
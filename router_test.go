@@ -0,0 +1,133 @@
+package xpp_test
+
+import (
+	"errors"
+	"testing"
+
+	xpp "github.com/mmcdole/goxpp/v2"
+)
+
+func TestRouterDispatchAndSkip(t *testing.T) {
+	doc := `<channel xmlns:dc="http://purl.org/dc/elements/1.1/">
+		<Title>Feed</Title>
+		<unknown><deep>ignored</deep></unknown>
+		<dc:creator>me</dc:creator>
+		<item><title>one</title></item>
+	</channel>`
+	p := newParser(doc)
+	advanceTo(t, p, "channel")
+
+	var title, creator, itemTitle string
+	item := xpp.NewRouter()
+	item.Handle("title", func(p *xpp.Parser) (err error) {
+		itemTitle, err = p.NextText()
+		return err
+	})
+
+	r := xpp.NewRouter()
+	r.Handle("title", func(p *xpp.Parser) (err error) {
+		title, err = p.NextText()
+		return err
+	})
+	r.HandleAll("http://purl.org/DC/elements/1.1/", "creator", func(p *xpp.Parser) (err error) {
+		creator, err = p.NextText()
+		return err
+	})
+	r.Handle("item", item.Children)
+
+	if err := r.Children(p); err != nil {
+		t.Fatalf("Children: %v", err)
+	}
+	if title != "Feed" || creator != "me" || itemTitle != "one" {
+		t.Fatalf("title %q creator %q item title %q", title, creator, itemTitle)
+	}
+	if p.Event() != xpp.EndTag || p.Name() != "channel" {
+		t.Fatalf("cursor = %v %q, want EndTag channel", p.Event(), p.Name())
+	}
+}
+
+func TestRouterSpecificity(t *testing.T) {
+	var got string
+	mark := func(s string) xpp.HandlerFunc {
+		return func(p *xpp.Parser) error {
+			got = s
+			return p.Skip()
+		}
+	}
+
+	r := xpp.NewRouter()
+	r.HandleAll("*", "*", mark("any"))
+	r.HandleAll("http://a", "*", mark("space"))
+	r.Handle("x", mark("name"))
+	r.HandleAll("http://a", "x", mark("exact"))
+
+	cases := []struct {
+		space, name, want string
+	}{
+		{"http://a", "X", "exact"},
+		{"http://b", "x", "name"},
+		{"http://a", "y", "space"},
+		{"http://b", "y", "any"},
+	}
+	for _, c := range cases {
+		got = ""
+		h := r.Lookup(c.space, c.name)
+		if h == nil {
+			t.Fatalf("Lookup(%s, %s) = nil", c.space, c.name)
+		}
+		p := newParser(`<` + c.name + ` xmlns="` + c.space + `"/>`)
+		advanceTo(t, p, c.name)
+		if err := h(p); err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("Lookup(%s, %s) dispatched to %q, want %q", c.space, c.name, got, c.want)
+		}
+	}
+
+	// Re-registering a pair replaces its handler.
+	r.Handle("X", mark("replaced"))
+	p := newParser(`<x/>`)
+	advanceTo(t, p, "x")
+	if err := r.Lookup("", "x")(p); err != nil {
+		t.Fatal(err)
+	}
+	if got != "replaced" {
+		t.Fatalf("after re-register dispatched to %q, want replaced", got)
+	}
+}
+
+func TestRouterHandlerMustConsumeElement(t *testing.T) {
+	p := newParser(`<root><a><b/></a></root>`)
+	advanceTo(t, p, "root")
+
+	r := xpp.NewRouter()
+	r.Handle("a", func(p *xpp.Parser) error {
+		_, err := p.NextTag() // leaves the cursor on <b>
+		return err
+	})
+	err := r.Children(p)
+	var ee *xpp.ExpectError
+	if !errors.As(err, &ee) {
+		t.Fatalf("err = %v, want *ExpectError", err)
+	}
+	if ee.WantEvent != xpp.EndTag || ee.WantName != "a" {
+		t.Fatalf("ExpectError = %+v, want EndTag a", ee)
+	}
+}
+
+func TestRouterPreconditionAndHandlerError(t *testing.T) {
+	p := newParser(`<root><a/></root>`)
+	r := xpp.NewRouter()
+	var ee *xpp.ExpectError
+	if err := r.Children(p); !errors.As(err, &ee) {
+		t.Fatalf("Children before StartTag: err = %v, want *ExpectError", err)
+	}
+
+	boom := errors.New("boom")
+	r.Handle("a", func(*xpp.Parser) error { return boom })
+	advanceTo(t, p, "root")
+	if err := r.Children(p); !errors.Is(err, boom) {
+		t.Fatalf("err = %v, want handler error", err)
+	}
+}
@@ -0,0 +1,69 @@
+package xpp
+
+import "time"
+
+// Stats reports what a parser has done so far. The counters are kept for
+// every parser; they cost a few increments and two clock reads per token.
+type Stats struct {
+	// Events counts the events the cursor has been on, by type. The
+	// tokens inside an element read by DecodeElement are not included.
+	Events map[EventType]int
+	// MaxDepth is the deepest element nesting reached.
+	MaxDepth int
+	// BytesRead is the input consumed, as InputOffset reports it.
+	BytesRead int64
+	// SkippedSubtrees counts elements passed over by Skip, and
+	// SkippedBytes the input Skip read for them, after their start tags.
+	SkippedSubtrees int
+	SkippedBytes    int64
+	// NamespaceScopes counts start tags that declared namespaces.
+	NamespaceScopes int
+	// DecoderTime is the time spent in encoding/xml reading tokens and in
+	// DecodeElement.
+	DecoderTime time.Duration
+}
+
+// numEvents is the number of EventType values.
+const numEvents = int(EntityRef) + 1
+
+// stats holds the counters behind Stats.
+type stats struct {
+	events          [numEvents]int
+	maxDepth        int
+	skippedSubtrees int
+	skippedBytes    int64
+	nsScopes        int
+	decoderTime     time.Duration
+}
+
+// Stats returns a snapshot of the parser's counters.
+func (p *Parser) Stats() Stats {
+	s := Stats{
+		Events:          map[EventType]int{},
+		MaxDepth:        p.stats.maxDepth,
+		BytesRead:       p.InputOffset(),
+		SkippedSubtrees: p.stats.skippedSubtrees,
+		SkippedBytes:    p.stats.skippedBytes,
+		NamespaceScopes: p.stats.nsScopes,
+		DecoderTime:     p.stats.decoderTime,
+	}
+	for e, n := range p.stats.events {
+		if n > 0 {
+			s.Events[EventType(e)] = n
+		}
+	}
+	return s
+}
+
+// countEvent records the event the cursor just arrived on.
+func (p *Parser) countEvent() {
+	if int(p.event) < numEvents {
+		p.stats.events[p.event]++
+	}
+	if p.event == StartTag {
+		p.stats.maxDepth = max(p.stats.maxDepth, p.depth)
+		if len(p.nsStack[len(p.nsStack)-1].decls) > 0 {
+			p.stats.nsScopes++
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package xpp_test
+
+import (
+	"testing"
+
+	xpp "github.com/mmcdole/goxpp/v2"
+)
+
+func TestStats(t *testing.T) {
+	doc := `<r xmlns="urn:r"><a xmlns:x="urn:x"><b><c/></b></a><!-- c --><d>text</d></r>`
+	p := newParser(doc)
+	advanceTo(t, p, "a")
+	if err := p.Skip(); err != nil {
+		t.Fatal(err)
+	}
+	advanceTo(t, p, "d")
+	var d string
+	if err := p.DecodeElement(&d); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		tok, err := p.NextToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok == xpp.EndDocument {
+			break
+		}
+	}
+
+	s := p.Stats()
+	want := map[xpp.EventType]int{xpp.StartTag: 5, xpp.EndTag: 5, xpp.Comment: 1, xpp.EndDocument: 1}
+	if len(s.Events) != len(want) {
+		t.Fatalf("Events = %v, want %v", s.Events, want)
+	}
+	for e, n := range want {
+		if s.Events[e] != n {
+			t.Errorf("Events[%s] = %d, want %d", e, s.Events[e], n)
+		}
+	}
+	if s.MaxDepth != 4 || s.NamespaceScopes != 2 || s.BytesRead != int64(len(doc)) {
+		t.Fatalf("MaxDepth %d NamespaceScopes %d BytesRead %d", s.MaxDepth, s.NamespaceScopes, s.BytesRead)
+	}
+	if s.SkippedSubtrees != 1 || s.SkippedBytes != int64(len(`<b><c/></b></a>`)) {
+		t.Fatalf("skipped %d subtrees, %d bytes", s.SkippedSubtrees, s.SkippedBytes)
+	}
+	if s.DecoderTime <= 0 {
+		t.Fatal("DecoderTime not recorded")
+	}
+}
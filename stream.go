@@ -0,0 +1,108 @@
+package xpp
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"io"
+)
+
+// OpenStream reads up to the root start tag of a long-lived stream, such
+// as XMPP's <stream:stream>, whose root only closes when the session ends.
+// The root's name and attributes, namespace declarations included, are
+// then available from StreamHeader, and NextStanza delivers its children.
+func (p *Parser) OpenStream() error {
+	t, err := p.NextTag()
+	if err != nil {
+		return err
+	}
+	if t != StartTag {
+		return p.expectErr(StartTag, "*", "*")
+	}
+	p.streamHeader = &xml.StartElement{
+		Name: xml.Name{Space: p.space, Local: p.name},
+		Attr: append([]xml.Attr(nil), p.attrs...),
+	}
+	return nil
+}
+
+// StreamHeader returns the root start tag read by OpenStream, or nil
+// before the stream is opened.
+func (p *Parser) StreamHeader() *xml.StartElement { return p.streamHeader }
+
+// NextStanza advances to the start tag of the stream's next child element
+// (a stanza, at depth 2) and returns StartTag. Whatever is left of the
+// previous stanza is skipped first, and whitespace between stanzas, such
+// as keepalives, is ignored. When the peer closes the stream it returns
+// EndTag on the root; after that, EndDocument. Input that ends with the
+// stream still open is the decoder's "unexpected EOF" syntax error, or
+// ErrUnexpectedEOF with WithRecovery.
+//
+// NextStanza never reads past the token it returns, so a stanza read with
+// DecodeElement, Bind or the cursor methods is complete as soon as its end
+// tag arrives, without waiting for more input.
+func (p *Parser) NextStanza() (EventType, error) {
+	if p.streamHeader == nil {
+		return p.event, errors.New("xpp: NextStanza called before OpenStream")
+	}
+	for p.depth > 2 || (p.depth == 2 && p.event != EndTag) {
+		t, err := p.Next()
+		if err != nil {
+			return t, err
+		}
+		if t == EndDocument {
+			return t, unexpectedEOF("reading the stream")
+		}
+	}
+	for {
+		t, err := p.Next()
+		if err != nil {
+			return t, err
+		}
+		switch {
+		case t == EndDocument && p.depth > 0:
+			return t, unexpectedEOF("reading the stream")
+		case t == StartTag, t == EndTag, t == EndDocument:
+			return t, nil
+		case t == Text && p.IsWhitespace():
+			continue
+		}
+		return t, p.expectAny(Expected{StartTag, "*", "*"}, Expected{EndTag, "*", "*"})
+	}
+}
+
+// RestartStream resets the parser for the new stream a peer opens after
+// negotiating STARTTLS or SASL, then reads its header as OpenStream does.
+// Pass the connection to read from, such as the TLS connection wrapping
+// the old one, or nil to continue on the same input, which requires a
+// parser from NewReader. Decoder settings carry over; the parser's state
+// is reset as NextDocument resets it.
+func (p *Parser) RestartStream(r io.Reader) error {
+	if p.err != nil {
+		return p.err
+	}
+	if p.tape != nil {
+		return errors.New("xpp: RestartStream on a replayed parser")
+	}
+	off := p.InputOffset()
+	if r != nil {
+		br, ok := r.(io.ByteReader)
+		if !ok {
+			br = bufio.NewReader(r)
+		}
+		p.src = &source{r: br}
+		off = 0
+	} else if p.src == nil {
+		return errors.New("xpp: RestartStream on the same input requires a parser from NewReader")
+	}
+
+	p.resetDocument()
+	p.streamHeader = nil
+	p.inputEnded = false
+	p.pending = nil
+	if err := p.restart(off); err != nil {
+		p.err = err
+		return err
+	}
+	return p.OpenStream()
+}
@@ -0,0 +1,143 @@
+package xpp_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	xpp "github.com/mmcdole/goxpp/v2"
+)
+
+var errWouldBlock = errors.New("read past the available input")
+
+// connReader hands out only the chunks a test has made available, like a
+// connection whose peer has not sent anything more yet.
+type connReader struct {
+	chunks []string
+}
+
+func (c *connReader) send(s string) { c.chunks = append(c.chunks, s) }
+
+func (c *connReader) Read(b []byte) (int, error) {
+	if len(c.chunks) == 0 {
+		return 0, errWouldBlock
+	}
+	n := copy(b, c.chunks[0])
+	c.chunks[0] = c.chunks[0][n:]
+	if c.chunks[0] == "" {
+		c.chunks = c.chunks[1:]
+	}
+	return n, nil
+}
+
+const streamHeader = `<?xml version='1.0'?><stream:stream xmlns='jabber:client' xmlns:stream='http://etherx.jabber.org/streams' id='%s' version='1.0'>`
+
+func TestStreamStanzasWithoutReadAhead(t *testing.T) {
+	conn := &connReader{}
+	p := xpp.NewReader(conn)
+
+	conn.send(strings.Replace(streamHeader, "%s", "s1", 1))
+	if err := p.OpenStream(); err != nil {
+		t.Fatal(err)
+	}
+	h := p.StreamHeader()
+	if h.Name.Local != "stream" || h.Name.Space != "http://etherx.jabber.org/streams" {
+		t.Fatalf("StreamHeader name = %+v", h.Name)
+	}
+	if p.Attribute("id") != "s1" || p.Attribute("version") != "1.0" {
+		t.Fatalf("header attributes = %+v", p.Attrs())
+	}
+
+	conn.send(`<message to='juliet@example.com'><body>hi</body></message>`)
+	if tok, err := p.NextStanza(); err != nil || tok != xpp.StartTag || p.Name() != "message" {
+		t.Fatalf("NextStanza = %s %s (%v)", tok, p.Name(), err)
+	}
+	var msg struct {
+		To   string `xml:"to,attr"`
+		Body string `xml:"body"`
+	}
+	if err := p.DecodeElement(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.To != "juliet@example.com" || msg.Body != "hi" || p.Space() != "jabber:client" {
+		t.Fatalf("message = %+v in %q", msg, p.Space())
+	}
+
+	// A keepalive, then a stanza left partly unread.
+	conn.send(" ")
+	conn.send(`<iq id='1'><query><item/></query></iq>`)
+	if tok, err := p.NextStanza(); err != nil || tok != xpp.StartTag || p.Attribute("id") != "1" {
+		t.Fatalf("NextStanza = %s %s (%v)", tok, p.Name(), err)
+	}
+	advanceTo(t, p, "query")
+
+	conn.send(`<presence/>`)
+	if tok, err := p.NextStanza(); err != nil || tok != xpp.StartTag || p.Name() != "presence" {
+		t.Fatalf("NextStanza = %s %s (%v), want the rest of iq skipped", tok, p.Name(), err)
+	}
+
+	conn.send(`</stream:stream>`)
+	if tok, err := p.NextStanza(); err != nil || tok != xpp.EndTag || p.Name() != "stream" {
+		t.Fatalf("NextStanza = %s %s (%v), want the stream closed", tok, p.Name(), err)
+	}
+}
+
+func TestStreamRestart(t *testing.T) {
+	conn := &connReader{}
+	p := xpp.NewReader(conn)
+	conn.send(strings.Replace(streamHeader, "%s", "s1", 1))
+	conn.send(`<success xmlns='urn:ietf:params:xml:ns:xmpp-sasl'/>`)
+	if err := p.OpenStream(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.NextStanza(); err != nil || p.Name() != "success" {
+		t.Fatalf("NextStanza = %s (%v)", p.Name(), err)
+	}
+	if err := p.Skip(); err != nil {
+		t.Fatal(err)
+	}
+
+	// After SASL the peer opens a new stream on the same connection.
+	conn.send(strings.Replace(streamHeader, "%s", "s2", 1))
+	if err := p.RestartStream(nil); err != nil {
+		t.Fatal(err)
+	}
+	if p.Attribute("id") != "s2" || p.Depth() != 1 || p.XMLDecl() == nil {
+		t.Fatalf("after restart: id %q depth %d", p.Attribute("id"), p.Depth())
+	}
+	conn.send(`<presence/>`)
+	if _, err := p.NextStanza(); err != nil || p.Name() != "presence" || p.Depth() != 2 {
+		t.Fatalf("NextStanza = %s depth %d (%v)", p.Name(), p.Depth(), err)
+	}
+
+	// After STARTTLS it continues on a new connection.
+	tls := &connReader{}
+	tls.send(strings.Replace(streamHeader, "%s", "s3", 1))
+	if err := p.RestartStream(tls); err != nil {
+		t.Fatal(err)
+	}
+	if p.Attribute("id") != "s3" || p.InputOffset() != int64(len(strings.Replace(streamHeader, "%s", "s3", 1))) {
+		t.Fatalf("after restart: id %q offset %d", p.Attribute("id"), p.InputOffset())
+	}
+}
+
+func TestStreamUnexpectedEnd(t *testing.T) {
+	p := xpp.NewReader(strings.NewReader(`<stream><a/>`), xpp.WithRecovery())
+	if err := p.OpenStream(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.NextStanza(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.NextStanza(); !errors.Is(err, xpp.ErrUnexpectedEOF) {
+		t.Fatalf("NextStanza = %v, want ErrUnexpectedEOF", err)
+	}
+
+	p = newParser(`<stream>`)
+	if err := p.OpenStream(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RestartStream(nil); err == nil {
+		t.Fatal("RestartStream(nil) should require a parser from NewReader")
+	}
+}
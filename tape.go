@@ -0,0 +1,234 @@
+package xpp
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Recorder writes every event a parser reaches to a tape, for replaying
+// the exact token sequence later with Replay. The tape is JSON lines, one
+// object per event holding the event type, name, namespace, attributes,
+// text, depth, input offset and, for start tags, the namespaces in scope
+// and the names and normalized attribute values as written, where known.
+// Events reached through DecodeElement are recorded as the element's
+// StartTag and EndTag only.
+type Recorder struct {
+	enc *json.Encoder
+	err error
+	p   *Parser
+	// prev is the recorder the parser had before this one, which keeps
+	// recording alongside it.
+	prev *Recorder
+}
+
+// NewRecorder starts recording p's events to w. Create it before the
+// first advancement call: a tape replays from the start of the document.
+// A failed write stops the recording, not the parse; see Err. Recorders
+// already attached to p keep recording alongside the new one.
+func NewRecorder(p *Parser, w io.Writer) *Recorder {
+	r := &Recorder{enc: json.NewEncoder(w), p: p, prev: p.recorder}
+	p.recorder = r
+	return r
+}
+
+// Stop detaches the recorder from its parser, which records nothing more
+// to its tape. Other recorders attached to the parser are unaffected.
+func (r *Recorder) Stop() {
+	if r.p == nil {
+		return
+	}
+	for link := &r.p.recorder; *link != nil; link = &(*link).prev {
+		if *link == r {
+			*link = r.prev
+			break
+		}
+	}
+	r.p, r.prev = nil, nil
+}
+
+// Err returns the first error writing the tape, after which nothing more
+// is recorded.
+func (r *Recorder) Err() error { return r.err }
+
+// tapeEvent is one line of a tape.
+type tapeEvent struct {
+	Event      string            `json:"e"`
+	Name       string            `json:"n,omitempty"`
+	Space      string            `json:"s,omitempty"`
+	QName      string            `json:"q,omitempty"`
+	Attrs      []tapeAttr        `json:"a,omitempty"`
+	Defaulted  int               `json:"da,omitempty"`
+	Text       string            `json:"t,omitempty"`
+	CDATA      bool              `json:"cd,omitempty"`
+	Resolved   bool              `json:"r,omitempty"`
+	Depth      int               `json:"d"`
+	Offset     int64             `json:"o"`
+	Namespaces map[string]string `json:"ns,omitempty"`
+}
+
+type tapeAttr struct {
+	Space string `json:"s,omitempty"`
+	Name  string `json:"n"`
+	Value string `json:"v"`
+	// QName and Normalized are AttrQName and, where it differs from
+	// Value, NormalizedAttr.
+	QName      string  `json:"q,omitempty"`
+	Normalized *string `json:"nv,omitempty"`
+}
+
+func (r *Recorder) record(p *Parser) {
+	if r.prev != nil {
+		r.prev.record(p)
+	}
+	if r.err != nil {
+		return
+	}
+	ev := tapeEvent{
+		Event:    p.event.String(),
+		Name:     p.name,
+		Space:    p.space,
+		Text:     p.text,
+		CDATA:    p.cdata,
+		Resolved: p.refOK,
+		Depth:    p.depth,
+		Offset:   p.InputOffset(),
+	}
+	if p.event == ProcessingInstruction && p.procInst != nil {
+		// Text is "target inst"; keep the parts apart for ProcInst.
+		ev.Name, ev.Text = p.procInst.Target, p.procInst.Inst
+	}
+	if p.event == StartTag {
+		ev.QName = p.nsStack[len(p.nsStack)-1].qname
+		for i, a := range p.attrs {
+			ta := tapeAttr{Space: a.Name.Space, Name: a.Name.Local, Value: a.Value, QName: p.AttrQName(i)}
+			if v := p.NormalizedAttr(i); v != a.Value {
+				ta.Normalized = &v
+			}
+			ev.Attrs = append(ev.Attrs, ta)
+		}
+		ev.Defaulted = len(p.attrs) - p.specified
+		ev.Namespaces = p.Namespaces()
+	}
+	r.err = r.enc.Encode(&ev)
+}
+
+// Replay returns a parser that reads its events from a tape written by a
+// Recorder, with the same accessor results as the recorded parser had:
+// namespaces, depth and base URLs are rebuilt from the recorded start
+// tags, and InputOffset reports the recorded offsets. It has no decoder,
+// so DecodeElement and RestartStream fail and Decoder returns nil; the
+// cursor methods, Bind and Router work, and with WithMultiDocument
+// NextDocument moves to the next recorded document. A tape that ends before EndDocument is an error
+// matching io.ErrUnexpectedEOF.
+func Replay(r io.Reader, opts ...Option) *Parser {
+	p := &Parser{event: StartDocument, tape: json.NewDecoder(r)}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+var eventsByName = func() map[string]EventType {
+	m := map[string]EventType{}
+	for e := StartDocument; e <= EntityRef; e++ {
+		m[e.String()] = e
+	}
+	return m
+}()
+
+func (p *Parser) replayToken() (EventType, error) {
+	var ev tapeEvent
+	if err := p.tape.Decode(&ev); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		p.err = fmt.Errorf("xpp: reading replay tape: %w", err)
+		return p.event, p.err
+	}
+	event, ok := eventsByName[ev.Event]
+	if !ok {
+		p.err = fmt.Errorf("xpp: replay tape has unknown event %q", ev.Event)
+		return p.event, p.err
+	}
+	p.offsetAdj = ev.Offset
+
+	name := xml.Name{Space: ev.Space, Local: ev.Name}
+	switch event {
+	case StartTag:
+		var attrs []xml.Attr
+		var written []writtenAttr
+		for _, a := range ev.Attrs {
+			attrs = append(attrs, xml.Attr{Name: xml.Name{Space: a.Space, Local: a.Name}, Value: a.Value})
+			w := writtenAttr{a.QName, a.Value}
+			if a.Normalized != nil {
+				w.value = *a.Normalized
+			}
+			written = append(written, w)
+		}
+		p.token = xml.StartElement{Name: name, Attr: attrs}
+		p.processToken(p.token)
+		p.specified = len(attrs) - ev.Defaulted
+		p.restoreScope(ev.QName, ev.Namespaces)
+		p.written, p.writtenDone = written, true
+	case EndTag:
+		p.token = xml.EndElement{Name: name}
+		p.processToken(p.token)
+	case Text, CDSect:
+		p.token = xml.CharData(ev.Text)
+		p.processToken(p.token)
+		p.event, p.cdata = event, ev.CDATA
+	case Comment:
+		p.token = xml.Comment(ev.Text)
+		p.processToken(p.token)
+	case ProcessingInstruction:
+		p.token = xml.ProcInst{Target: ev.Name, Inst: []byte(ev.Text)}
+		p.processToken(p.token)
+	case Directive:
+		p.token = xml.Directive(ev.Text)
+		p.processToken(p.token)
+	case EntityRef:
+		p.event, p.name, p.text, p.refOK = EntityRef, ev.Name, ev.Text, ev.Resolved
+	case EndDocument:
+		p.event = EndDocument
+		p.docEnded = true
+	default:
+		p.err = errors.New("xpp: replay tape has a " + ev.Event + " event")
+		return p.event, p.err
+	}
+	return p.event, nil
+}
+
+// restoreScope gives the replayed start tag the qualified name and
+// namespaces in scope that were recorded for it, which may include
+// bindings its attributes do not declare. Those are added as
+// declarations, so PrefixForURI finds them too.
+func (p *Parser) restoreScope(qname string, namespaces map[string]string) {
+	sc := &p.nsStack[len(p.nsStack)-1]
+	sc.qname = qname
+	if namespaces == nil {
+		return
+	}
+	var outer map[string]string
+	if n := len(p.nsStack); n > 1 {
+		outer = p.nsStack[n-2].bindings
+	}
+	prefixes := make([]string, 0, len(namespaces))
+	for prefix := range namespaces {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		uri := namespaces[prefix]
+		if cur, ok := sc.bindings[prefix]; ok && cur == uri {
+			continue
+		}
+		if cur, ok := outer[prefix]; !ok || cur != uri {
+			sc.decls = append(sc.decls, nsDecl{prefix: prefix, uri: uri})
+		}
+	}
+	sc.bindings = namespaces
+}
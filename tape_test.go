@@ -0,0 +1,206 @@
+package xpp_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	xpp "github.com/mmcdole/goxpp/v2"
+)
+
+// snapshot renders everything the accessors report for the current event.
+func snapshot(p *xpp.Parser) string {
+	s := fmt.Sprintf("%s name=%q space=%q text=%q depth=%d offset=%d cdata=%v attrs=%v ns=%v base=%v",
+		p.Event(), p.Name(), p.Space(), p.Text(), p.Depth(), p.InputOffset(), p.IsCDATA(),
+		p.Attrs(), p.Namespaces(), p.BaseURL())
+	for i := range p.Attrs() {
+		s += fmt.Sprintf(" default%d=%v qname%d=%q norm%d=%q", i, p.IsAttributeDefault(i), i, p.AttrQName(i), i, p.NormalizedAttr(i))
+	}
+	s += " qname=" + p.QName()
+	if lang, ok := p.Lang(); ok {
+		s += " lang=" + lang
+	}
+	if space, ok := p.XMLSpace(); ok {
+		s += " xmlspace=" + space
+	}
+	if pi := p.ProcInst(); pi != nil {
+		s += fmt.Sprintf(" pi=%+v", *pi)
+	}
+	if d := p.XMLDecl(); d != nil {
+		s += fmt.Sprintf(" decl=%+v", *d)
+	}
+	if dt := p.DocType(); dt != nil {
+		s += " doctype=" + dt.Name
+	}
+	if prefix, ok := p.PrefixForURI("urn:a"); ok {
+		s += " prefix=" + prefix
+	}
+	return s
+}
+
+const tapeDoc = `<?xml version="1.0"?>
+<!DOCTYPE feed [<!ATTLIST item kind CDATA "post">]>
+<feed xmlns="urn:d" xmlns:a="urn:a" xml:base="http://example.com/">
+  <!-- comment -->
+  <?render fast?>
+  <a:item id="1">one &amp; &nbsp; <![CDATA[<raw>]]></a:item>
+  <item xml:base="sub/" xml:lang="en" note="two
+lines&#10;"><title xml:space="preserve">t</title></item>
+</feed>`
+
+func TestRecordAndReplay(t *testing.T) {
+	var tape bytes.Buffer
+	p := xpp.NewReader(strings.NewReader(tapeDoc), xpp.WithEntityRefs(), xpp.WithDTDDefaults())
+	p.Decoder().Strict = false
+	rec := xpp.NewRecorder(p, &tape)
+
+	var want []string
+	for {
+		tok, err := p.NextToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, snapshot(p))
+		if tok == xpp.EndDocument {
+			break
+		}
+	}
+	if rec.Err() != nil {
+		t.Fatal(rec.Err())
+	}
+
+	r := xpp.Replay(bytes.NewReader(tape.Bytes()))
+	for i := 0; ; i++ {
+		tok, err := r.NextToken()
+		if err != nil {
+			t.Fatalf("replay event %d: %v", i, err)
+		}
+		if got := snapshot(r); got != want[i] {
+			t.Fatalf("replay event %d:\n got %s\nwant %s", i, got, want[i])
+		}
+		if tok == xpp.EndDocument {
+			break
+		}
+	}
+	if _, err := r.NextToken(); err != io.EOF {
+		t.Fatalf("NextToken after EndDocument = %v, want io.EOF", err)
+	}
+}
+
+func TestReplayDrivesCursorMethods(t *testing.T) {
+	var tape bytes.Buffer
+	p := newParser(`<r><skip><deep/></skip><v>text</v><d><x>1</x></d></r>`)
+	xpp.NewRecorder(p, &tape)
+	advanceTo(t, p, "v")
+	var v struct {
+		X string `xml:"x"`
+	}
+	advanceTo(t, p, "d")
+	if err := p.DecodeElement(&v); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.NextToken(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := xpp.Replay(&tape)
+	advanceTo(t, r, "skip")
+	if err := r.Skip(); err != nil {
+		t.Fatal(err)
+	}
+	advanceTo(t, r, "v")
+	if text, err := r.NextText(); err != nil || text != "text" {
+		t.Fatalf("NextText = %q (%v)", text, err)
+	}
+	advanceTo(t, r, "d")
+	if r.DecodeElement(&v) == nil {
+		t.Fatal("DecodeElement on a replayed parser should fail")
+	}
+	// DecodeElement was recorded as the element's start and end only.
+	if tok, err := r.NextToken(); err != nil || tok != xpp.EndTag || r.Name() != "d" {
+		t.Fatalf("NextToken = %s %s (%v), want EndTag d", tok, r.Name(), err)
+	}
+	if _, err := r.NextToken(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.NextToken(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("NextToken past a truncated tape = %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestRecorderStop(t *testing.T) {
+	var outer, inner bytes.Buffer
+	p := newParser(`<r><a/><b/></r>`)
+	rec := xpp.NewRecorder(p, &outer)
+	advanceTo(t, p, "a")
+	nested := xpp.NewRecorder(p, &inner)
+	advanceTo(t, p, "b")
+	nested.Stop()
+	for p.Event() != xpp.EndDocument {
+		if _, err := p.NextToken(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rec.Stop()
+	rec.Stop()
+
+	lines := func(b *bytes.Buffer) int { return strings.Count(b.String(), "\n") }
+	// outer: StartTag r, a, EndTag a, StartTag b, EndTag b, EndTag r,
+	// EndDocument; inner: EndTag a and StartTag b.
+	if lines(&outer) != 7 || lines(&inner) != 2 {
+		t.Errorf("recorded %d and %d events, want 7 and 2", lines(&outer), lines(&inner))
+	}
+}
+
+func TestReplayMultiDocument(t *testing.T) {
+	var tape bytes.Buffer
+	p := newParserWith(`<a x="1"><b/></a> <c/>`, xpp.WithMultiDocument())
+	xpp.NewRecorder(p, &tape)
+	want := collect(t, p)
+	if err := p.NextDocument(); err != nil {
+		t.Fatal(err)
+	}
+	want = append(want, collect(t, p)...)
+
+	r := xpp.Replay(&tape, xpp.WithMultiDocument())
+	got := collect(t, r)
+	if err := r.NextDocument(); err != nil {
+		t.Fatalf("NextDocument on a replayed parser: %v", err)
+	}
+	if r.Event() != xpp.StartDocument || r.Depth() != 0 {
+		t.Fatalf("after NextDocument: %s depth %d, want StartDocument depth 0", r.Event(), r.Depth())
+	}
+	got = append(got, collect(t, r)...)
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("replayed %v, want %v", got, want)
+	}
+	if err := r.NextDocument(); err != io.EOF {
+		t.Fatalf("NextDocument at the end of the tape = %v, want io.EOF", err)
+	}
+	if err := r.RestartStream(strings.NewReader("<a/>")); err == nil {
+		t.Fatal("RestartStream on a replayed parser should fail")
+	}
+}
+
+func TestReplayRestoresNamespaces(t *testing.T) {
+	// The binding of p is recorded but not declared by an attribute, as
+	// for a scope a replacement decoder was started in.
+	const tape = `{"e":"StartTag","n":"a","s":"urn:p","q":"p:a","d":1,"o":6,"ns":{"p":"urn:p"}}
+{"e":"EndTag","n":"a","s":"urn:p","d":1,"o":12}
+{"e":"EndDocument","d":0,"o":12}
+`
+	r := xpp.Replay(strings.NewReader(tape))
+	advanceTo(t, r, "a")
+	if ns := r.Namespaces(); len(ns) != 1 || ns["p"] != "urn:p" {
+		t.Fatalf("Namespaces = %v, want p bound to urn:p", ns)
+	}
+	if prefix, ok := r.PrefixForURI("urn:p"); !ok || prefix != "p" {
+		t.Fatalf("PrefixForURI = %q, %t, want p", prefix, ok)
+	}
+	if r.QName() != "p:a" {
+		t.Fatalf("QName = %q, want p:a", r.QName())
+	}
+}
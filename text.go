@@ -0,0 +1,202 @@
+package xpp
+
+import "strings"
+
+// SpaceMode is how NextTextWith normalizes whitespace. Whitespace is
+// space, tab, carriage return and newline.
+type SpaceMode int
+
+const (
+	// SpacePreserve returns the text as is.
+	SpacePreserve SpaceMode = iota
+	// SpaceReplace replaces each tab, carriage return and newline with a
+	// space, as XSD whiteSpace="replace".
+	SpaceReplace
+	// SpaceTrim removes leading and trailing whitespace.
+	SpaceTrim
+	// SpaceCollapse replaces each run of whitespace with a single space
+	// and trims the result, as XSD whiteSpace="collapse".
+	SpaceCollapse
+)
+
+// TextPolicy configures NextTextWith.
+type TextPolicy struct {
+	// Space normalizes the text, except where xml:space="preserve" is in
+	// effect for the element, which always preserves it.
+	Space SpaceMode
+	// Mixed accepts child elements: their subtrees are skipped and the
+	// element's own text around them is concatenated. Without it a child
+	// element is an *ExpectError, as from NextText.
+	Mixed bool
+}
+
+// NextTextWith is NextText under policy: it requires the parser to be on
+// a StartTag, consumes the element's text content, normalizes it, and
+// leaves the parser on the matching EndTag.
+func (p *Parser) NextTextWith(policy TextPolicy) (string, error) {
+	if p.event != StartTag {
+		return "", p.expectErr(StartTag, "*", "*")
+	}
+	preserve := p.nsStack[len(p.nsStack)-1].preserve
+
+	// The decoder emits a separate CharData token at every entity and CDATA
+	// boundary, so entity-heavy text arrives as many small fragments. Use a
+	// Builder to avoid quadratic string concatenation.
+	var sb strings.Builder
+	for {
+		t, err := p.Next()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case t == Text:
+			sb.WriteString(p.text)
+			continue
+		case t == StartTag && policy.Mixed:
+			if err := p.Skip(); err != nil {
+				return "", err
+			}
+			continue
+		case t != EndTag:
+			return "", p.expectAny(Expected{EndTag, "*", "*"}, Expected{Text, "*", "*"})
+		}
+		if preserve {
+			return sb.String(), nil
+		}
+		return normalizeSpace(sb.String(), policy.Space), nil
+	}
+}
+
+func normalizeSpace(s string, mode SpaceMode) string {
+	switch mode {
+	case SpaceReplace:
+		return strings.Map(func(r rune) rune {
+			if r == '\t' || r == '\r' || r == '\n' {
+				return ' '
+			}
+			return r
+		}, s)
+	case SpaceTrim:
+		return strings.Trim(s, " \t\r\n")
+	case SpaceCollapse:
+		return strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+			return r == ' ' || r == '\t' || r == '\r' || r == '\n'
+		}), " ")
+	}
+	return s
+}
+
+// pushSpace records the xml:space in effect for the element just pushed,
+// and its xml:lang: its own attributes, or else its parent's.
+func (p *Parser) pushSpace() {
+	n := len(p.nsStack)
+	sc := &p.nsStack[n-1]
+	if n > 1 {
+		parent := p.nsStack[n-2]
+		sc.preserve = parent.preserve
+		sc.lang, sc.hasLang = parent.lang, parent.hasLang
+		sc.xmlSpace, sc.hasXMLSpace = parent.xmlSpace, parent.hasXMLSpace
+	}
+	for _, attr := range p.attrs {
+		if attr.Name.Space != xmlNSURI {
+			continue
+		}
+		switch attr.Name.Local {
+		case "space":
+			sc.xmlSpace, sc.hasXMLSpace = attr.Value, true
+			switch attr.Value {
+			case "preserve":
+				sc.preserve = true
+			case "default":
+				sc.preserve = false
+			}
+		case "lang":
+			sc.lang, sc.hasLang = attr.Value, true
+		}
+	}
+}
+
+// blockElements is the default set of element names, in lower case, that
+// NextAllText separates: the block-level elements of HTML.
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"br": true, "dd": true, "details": true, "dialog": true, "div": true,
+	"dl": true, "dt": true, "fieldset": true, "figcaption": true,
+	"figure": true, "footer": true, "form": true, "h1": true, "h2": true,
+	"h3": true, "h4": true, "h5": true, "h6": true, "header": true,
+	"hr": true, "li": true, "main": true, "nav": true, "ol": true,
+	"p": true, "pre": true, "section": true, "table": true, "td": true,
+	"th": true, "tr": true, "ul": true,
+}
+
+// WithBlockElements replaces the set of elements NextAllText separates,
+// by default the block-level elements of HTML. Names are matched
+// case-insensitively and without regard to namespace.
+func WithBlockElements(names ...string) Option {
+	blocks := make(map[string]bool, len(names))
+	for _, name := range names {
+		blocks[strings.ToLower(name)] = true
+	}
+	return func(p *Parser) { p.blocks = blocks }
+}
+
+// NextAllText requires the parser to be on a StartTag and returns the text
+// of the element's entire subtree, descendants included, leaving the
+// parser on the matching EndTag as Skip does. If sep is not empty it is
+// inserted where a block element (see WithBlockElements) starts or ends
+// between two pieces of text, once per boundary, and whitespace-only text
+// next to a boundary or at the end is dropped, so <p>a</p> <p>b</p>
+// yields "a" + sep + "b".
+func (p *Parser) NextAllText(sep string) (string, error) {
+	if p.event != StartTag {
+		return "", p.expectErr(StartTag, "*", "*")
+	}
+	blocks := p.blocks
+	if blocks == nil {
+		blocks = blockElements
+	}
+	var sb strings.Builder
+	depth := 0
+	boundary := false
+	space := "" // whitespace-only text held back until the next boundary
+	for {
+		t, err := p.Next()
+		if err != nil {
+			return "", err
+		}
+		switch t {
+		case Text:
+			if sep == "" {
+				sb.WriteString(p.text)
+				continue
+			}
+			if p.IsWhitespace() {
+				if !boundary {
+					space += p.text
+				}
+				continue
+			}
+			if boundary && sb.Len() > 0 {
+				sb.WriteString(sep)
+			} else {
+				sb.WriteString(space)
+			}
+			boundary, space = false, ""
+			sb.WriteString(p.text)
+		case StartTag, EndTag:
+			if t == EndTag && depth == 0 {
+				return sb.String(), nil
+			}
+			if t == StartTag {
+				depth++
+			} else {
+				depth--
+			}
+			if blocks[strings.ToLower(p.name)] {
+				boundary, space = true, ""
+			}
+		case EndDocument:
+			return "", unexpectedEOF("reading element text")
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package xpp_test
+
+import (
+	"errors"
+	"testing"
+
+	xpp "github.com/mmcdole/goxpp/v2"
+)
+
+func TestNextTextWithSpaceModes(t *testing.T) {
+	const doc = "<r><t>\n\t  a \t b\r\n  </t></r>"
+	tests := []struct {
+		mode xpp.SpaceMode
+		want string
+	}{
+		{xpp.SpacePreserve, "\n\t  a \t b\n  "},
+		{xpp.SpaceReplace, "    a   b   "},
+		{xpp.SpaceTrim, "a \t b"},
+		{xpp.SpaceCollapse, "a b"},
+	}
+	for _, tt := range tests {
+		p := newParser(doc)
+		advanceTo(t, p, "t")
+		got, err := p.NextTextWith(xpp.TextPolicy{Space: tt.mode})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("mode %d: %q, want %q", tt.mode, got, tt.want)
+		}
+		if p.Event() != xpp.EndTag || p.Name() != "t" {
+			t.Errorf("mode %d: cursor = %s %s, want EndTag t", tt.mode, p.Event(), p.Name())
+		}
+	}
+}
+
+func TestNextTextWithXMLSpace(t *testing.T) {
+	p := newParser(`<r xml:space="preserve"><pre>  keep  </pre><p xml:space="default">  trim  </p></r>`)
+	collapse := xpp.TextPolicy{Space: xpp.SpaceCollapse}
+
+	advanceTo(t, p, "pre")
+	if got, _ := p.NextTextWith(collapse); got != "  keep  " {
+		t.Fatalf("inherited xml:space=preserve: %q", got)
+	}
+	advanceTo(t, p, "p")
+	if got, _ := p.NextTextWith(collapse); got != "trim" {
+		t.Fatalf("xml:space=default: %q", got)
+	}
+}
+
+func TestNextTextWithMixedContent(t *testing.T) {
+	const doc = `<d>Hello <b>bold <i>x</i></b> world</d>`
+	p := newParser(doc)
+	advanceTo(t, p, "d")
+	var expect *xpp.ExpectError
+	if _, err := p.NextTextWith(xpp.TextPolicy{}); !errors.As(err, &expect) {
+		t.Fatalf("NextTextWith = %v, want *ExpectError without Mixed", err)
+	}
+	if expect.WantEvent != xpp.EndTag || expect.GotEvent != xpp.StartTag {
+		t.Errorf("WantEvent, GotEvent = %s, %s, want EndTag, StartTag", expect.WantEvent, expect.GotEvent)
+	}
+
+	p = newParser(doc)
+	advanceTo(t, p, "d")
+	got, err := p.NextTextWith(xpp.TextPolicy{Space: xpp.SpaceCollapse, Mixed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "Hello world" || p.Event() != xpp.EndTag || p.Name() != "d" {
+		t.Fatalf("NextTextWith = %q on %s %s, want the own text and EndTag d", got, p.Event(), p.Name())
+	}
+}
+
+func TestNextAllText(t *testing.T) {
+	const doc = `<item><description>Intro <b>bold</b>,<![CDATA[ raw]]>
+  <p>First &amp; <i>one</i>.</p>
+  <ul><li>a</li><li>b</li></ul>tail<br/>end</description><next/></item>`
+	p := newParser(doc)
+	advanceTo(t, p, "description")
+	got, err := p.NextAllText("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Intro bold, raw\n  First & one.\n  abtailend"; got != want {
+		t.Fatalf("NextAllText(\"\") = %q, want %q", got, want)
+	}
+	if p.Event() != xpp.EndTag || p.Name() != "description" {
+		t.Fatalf("cursor = %s %s, want EndTag description", p.Event(), p.Name())
+	}
+
+	p = newParser(doc)
+	advanceTo(t, p, "description")
+	got, err = p.NextAllText("\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Intro bold, raw\nFirst & one.\na\nb\ntail\nend"; got != want {
+		t.Fatalf("NextAllText(\"\\n\") = %q, want %q", got, want)
+	}
+	advanceTo(t, p, "next")
+
+	p = newParserWith(doc, xpp.WithBlockElements("P", "b"))
+	advanceTo(t, p, "description")
+	got, err = p.NextAllText("|")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Intro |bold|, raw|First & one.|abtailend"; got != want {
+		t.Fatalf("WithBlockElements: NextAllText = %q, want %q", got, want)
+	}
+}
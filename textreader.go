@@ -0,0 +1,83 @@
+package xpp
+
+import (
+	"encoding/base64"
+	"io"
+)
+
+// TextReader requires the parser to be on a StartTag and returns a reader
+// over the element's text content, as NextText would return it. The
+// content is read from the decoder as the reader is read, a text token at
+// a time, so it is never held in full: only the largest single text token
+// is, which encoding/xml materializes. At io.EOF the parser is on the
+// matching EndTag. A child element makes Read fail with an *ExpectError.
+// Do not move the cursor while the reader is in use.
+func (p *Parser) TextReader() (io.Reader, error) {
+	if p.event != StartTag {
+		return nil, p.expectErr(StartTag, "*", "*")
+	}
+	return &textReader{p: p}, nil
+}
+
+// Base64Reader is TextReader for base64 (standard encoding) content,
+// decoded as it is read. Whitespace in the content is ignored.
+func (p *Parser) Base64Reader() (io.Reader, error) {
+	r, err := p.TextReader()
+	if err != nil {
+		return nil, err
+	}
+	return base64.NewDecoder(base64.StdEncoding, &spaceStripper{r: r}), nil
+}
+
+type textReader struct {
+	p    *Parser
+	buf  string
+	done bool
+	err  error
+}
+
+func (r *textReader) Read(b []byte) (int, error) {
+	for r.buf == "" {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		t, err := r.p.Next()
+		switch {
+		case err != nil:
+			r.err = err
+		case t == Text:
+			r.buf = r.p.text
+		case t == EndTag:
+			r.done = true
+		default:
+			r.err = r.p.expectAny(Expected{EndTag, "*", "*"}, Expected{Text, "*", "*"})
+		}
+	}
+	n := copy(b, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// spaceStripper drops XML whitespace, which base64 decoding would reject.
+type spaceStripper struct {
+	r io.Reader
+}
+
+func (s *spaceStripper) Read(b []byte) (int, error) {
+	for {
+		n, err := s.r.Read(b)
+		kept := 0
+		for _, c := range b[:n] {
+			if !isSpaceByte(c) {
+				b[kept] = c
+				kept++
+			}
+		}
+		if kept > 0 || err != nil {
+			return kept, err
+		}
+	}
+}
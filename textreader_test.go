@@ -0,0 +1,77 @@
+package xpp_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	xpp "github.com/mmcdole/goxpp/v2"
+)
+
+func TestTextReader(t *testing.T) {
+	p := newParser(`<r><a>one &amp; <![CDATA[two]]><!-- c --> three</a></r>`)
+	advanceTo(t, p, "a")
+	r, err := p.TextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(text) != "one & two three" {
+		t.Fatalf("text = %q", text)
+	}
+	if p.Event() != xpp.EndTag || p.Name() != "a" {
+		t.Fatalf("cursor = %s %s, want EndTag a", p.Event(), p.Name())
+	}
+}
+
+func TestTextReaderChildElement(t *testing.T) {
+	p := newParser(`<a>x<b/></a>`)
+	advanceTo(t, p, "a")
+	r, err := p.TextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expect *xpp.ExpectError
+	if _, err := io.ReadAll(r); !errors.As(err, &expect) {
+		t.Fatalf("ReadAll = %v, want *ExpectError", err)
+	}
+	if p.Event() != xpp.StartTag || p.Name() != "b" {
+		t.Fatalf("cursor = %s %s, want the child's StartTag", p.Event(), p.Name())
+	}
+	p.Next()
+	if _, err := p.TextReader(); err == nil {
+		t.Fatal("TextReader off a StartTag should fail")
+	}
+}
+
+func TestBase64Reader(t *testing.T) {
+	payload := strings.Repeat("attachment bytes \x00\xff ", 5000)
+	enc := base64.StdEncoding.EncodeToString([]byte(payload))
+	var wrapped strings.Builder
+	for i := 0; i < len(enc); i += 76 {
+		wrapped.WriteString("\n    ")
+		wrapped.WriteString(enc[i:min(i+76, len(enc))])
+	}
+	p := newParser(`<msg><data>` + wrapped.String() + "\n  </data><next/></msg>")
+	advanceTo(t, p, "data")
+	r, err := p.Base64Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != payload {
+		t.Fatalf("decoded %d bytes, want %d", len(got), len(payload))
+	}
+	if p.Event() != xpp.EndTag || p.Name() != "data" {
+		t.Fatalf("cursor = %s %s, want EndTag data", p.Event(), p.Name())
+	}
+	advanceTo(t, p, "next")
+}
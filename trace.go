@@ -0,0 +1,50 @@
+package xpp
+
+import "time"
+
+// Tracer observes a parser's work, for structured logging or metrics. Its
+// Trace method is called synchronously, so it should be cheap.
+type Tracer interface {
+	Trace(t Trace)
+}
+
+// TracerFunc adapts a function to Tracer.
+type TracerFunc func(t Trace)
+
+// Trace calls f(t).
+func (f TracerFunc) Trace(t Trace) { f(t) }
+
+// Trace describes one traced call. Op is "NextToken", "Skip" or
+// "DecodeElement" after each such call, including those made by other
+// methods (Next and NextText advance through NextToken), or "Expect" when
+// a positional check fails, whichever method made it. The position fields
+// describe the cursor once the call has returned, and Duration is the
+// time it took, zero for "Expect".
+type Trace struct {
+	Op          string
+	Event       EventType
+	Space, Name string
+	Depth       int
+	Offset      int64
+	Duration    time.Duration
+	Err         error
+}
+
+// WithTracer sends a Trace to t for every advancement call and failed
+// positional check.
+func WithTracer(t Tracer) Option {
+	return func(p *Parser) { p.tracer = t }
+}
+
+func (p *Parser) trace(op string, start time.Time, err error) {
+	t := Trace{
+		Op:    op,
+		Event: p.event, Space: p.space, Name: p.name,
+		Depth: p.depth, Offset: p.InputOffset(),
+		Err: err,
+	}
+	if !start.IsZero() {
+		t.Duration = time.Since(start)
+	}
+	p.tracer.Trace(t)
+}
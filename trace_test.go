@@ -0,0 +1,46 @@
+package xpp_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	xpp "github.com/mmcdole/goxpp/v2"
+)
+
+func TestTracer(t *testing.T) {
+	var traces []xpp.Trace
+	tracer := xpp.TracerFunc(func(tr xpp.Trace) { traces = append(traces, tr) })
+	p := newParserWith(`<r><a><b/></a><c>1</c></r>`, xpp.WithTracer(tracer))
+
+	advanceTo(t, p, "a")
+	if err := p.Skip(); err != nil {
+		t.Fatal(err)
+	}
+	advanceTo(t, p, "c")
+	var c int
+	if err := p.DecodeElement(&c); err != nil {
+		t.Fatal(err)
+	}
+	if p.Expect(xpp.StartTag, "c") == nil {
+		t.Fatal("Expect on an EndTag should fail")
+	}
+
+	var ops []string
+	for _, tr := range traces {
+		ops = append(ops, tr.Op)
+	}
+	want := "NextToken NextToken NextToken NextToken NextToken Skip NextToken DecodeElement Expect"
+	if got := strings.Join(ops, " "); got != want {
+		t.Fatalf("ops = %s\nwant  %s", got, want)
+	}
+
+	skip := traces[5]
+	if skip.Event != xpp.EndTag || skip.Name != "a" || skip.Depth != 2 || skip.Offset != int64(len("<r><a><b/></a>")) {
+		t.Fatalf("Skip trace = %+v, want the cursor on </a>", skip)
+	}
+	expect := traces[len(traces)-1]
+	if !errors.Is(expect.Err, xpp.ErrUnexpectedEvent) || expect.Duration != 0 {
+		t.Fatalf("Expect trace = %+v", expect)
+	}
+}
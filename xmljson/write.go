@@ -0,0 +1,295 @@
+package xmljson
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// Write reads one JSON value from r, as Convert writes it under
+// opts.Convention, and writes the XML it describes to w. It streams: JSON
+// tokens are written out as they are read. Element and attribute names
+// are written as qualified in the JSON, and BadgerFish "@xmlns" members
+// become the namespace declarations not already in scope. A key that is
+// not a valid XML qualified name, or prefix for "@xmlns", is an error.
+//
+// As a start tag is written before the element's content, an element's
+// attributes (and "@xmlns") must come before its children and text in the
+// JSON object; Convert writes them in that order. Numbers are written as
+// they appear in the JSON.
+func Write(w io.Writer, r io.Reader, opts Options) error {
+	d := json.NewDecoder(r)
+	d.UseNumber()
+	x := &xmlWriter{d: d, e: xml.NewEncoder(w), conv: opts.Convention}
+
+	tok, err := d.Token()
+	if err != nil {
+		return err
+	}
+	if opts.Convention == Parker {
+		root := opts.Root
+		if root == "" {
+			root = "root"
+		}
+		err = x.element(root, tok)
+	} else {
+		err = x.root(tok)
+	}
+	if err != nil {
+		return err
+	}
+	return x.e.Flush()
+}
+
+type xmlWriter struct {
+	d    *json.Decoder
+	e    *xml.Encoder
+	conv Convention
+	// scopes holds the namespace bindings in scope for each open element.
+	scopes []map[string]string
+}
+
+// root handles the top-level object of BadgerFish and Attributes, whose
+// single member is the root element.
+func (x *xmlWriter) root(tok json.Token) error {
+	if tok != json.Delim('{') {
+		return fmt.Errorf("xmljson: top-level value is %v, want an object", tok)
+	}
+	if !x.d.More() {
+		return errors.New("xmljson: top-level object is empty")
+	}
+	name, err := x.key()
+	if err != nil {
+		return err
+	}
+	if err := x.member(name); err != nil {
+		return err
+	}
+	if x.d.More() {
+		return errors.New("xmljson: top-level object has more than one member")
+	}
+	_, err = x.d.Token()
+	return err
+}
+
+func (x *xmlWriter) key() (string, error) {
+	tok, err := x.d.Token()
+	if err != nil {
+		return "", err
+	}
+	return tok.(string), nil
+}
+
+// member writes the element or elements named by an object member.
+func (x *xmlWriter) member(name string) error {
+	tok, err := x.d.Token()
+	if err != nil {
+		return err
+	}
+	if tok != json.Delim('[') {
+		return x.element(name, tok)
+	}
+	for x.d.More() {
+		if tok, err = x.d.Token(); err != nil {
+			return err
+		}
+		if tok == json.Delim('[') {
+			return fmt.Errorf("xmljson: nested array in %s", name)
+		}
+		if err := x.element(name, tok); err != nil {
+			return err
+		}
+	}
+	_, err = x.d.Token()
+	return err
+}
+
+// element writes the element name whose value starts with tok.
+func (x *xmlWriter) element(name string, tok json.Token) error {
+	if !isQName(name) {
+		return fmt.Errorf("xmljson: %q is not a valid element name", name)
+	}
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if tok == json.Delim('{') {
+		return x.object(start)
+	}
+	if tok == json.Delim('[') {
+		return fmt.Errorf("xmljson: nested array in %s", name)
+	}
+	if err := x.e.EncodeToken(start); err != nil {
+		return err
+	}
+	if text, ok := scalar(tok); ok && text != "" {
+		if err := x.e.EncodeToken(xml.CharData(text)); err != nil {
+			return err
+		}
+	}
+	return x.e.EncodeToken(start.End())
+}
+
+// object writes an element from its object value, whose '{' has been
+// read.
+func (x *xmlWriter) object(start xml.StartElement) error {
+	scope := map[string]string{}
+	if n := len(x.scopes); n > 0 {
+		for k, v := range x.scopes[n-1] {
+			scope[k] = v
+		}
+	}
+	x.scopes = append(x.scopes, scope)
+	defer func() { x.scopes = x.scopes[:len(x.scopes)-1] }()
+
+	started := false
+	open := func() error {
+		if started {
+			return nil
+		}
+		started = true
+		return x.e.EncodeToken(start)
+	}
+	for x.d.More() {
+		key, err := x.key()
+		if err != nil {
+			return err
+		}
+		attr := x.conv != Parker && strings.HasPrefix(key, "@")
+		if attr && started {
+			return fmt.Errorf("xmljson: attribute %s of %s follows its content", key, start.Name.Local)
+		}
+		switch {
+		case attr && key == "@xmlns" && x.conv == BadgerFish:
+			if err := x.namespaces(&start, scope); err != nil {
+				return err
+			}
+		case attr:
+			tok, err := x.d.Token()
+			if err != nil {
+				return err
+			}
+			value, ok := scalar(tok)
+			if !ok {
+				return fmt.Errorf("xmljson: attribute %s of %s is not a scalar", key, start.Name.Local)
+			}
+			if !isQName(key[1:]) {
+				return fmt.Errorf("xmljson: %q of %s is not a valid attribute name", key, start.Name.Local)
+			}
+			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: key[1:]}, Value: value})
+		case (x.conv == BadgerFish && key == "$") || (x.conv == Attributes && key == "#text"):
+			tok, err := x.d.Token()
+			if err != nil {
+				return err
+			}
+			text, ok := scalar(tok)
+			if !ok {
+				return fmt.Errorf("xmljson: text of %s is not a scalar", start.Name.Local)
+			}
+			if err := open(); err != nil {
+				return err
+			}
+			if err := x.e.EncodeToken(xml.CharData(text)); err != nil {
+				return err
+			}
+		default:
+			if err := open(); err != nil {
+				return err
+			}
+			if err := x.member(key); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := x.d.Token(); err != nil {
+		return err
+	}
+	if err := open(); err != nil {
+		return err
+	}
+	return x.e.EncodeToken(start.End())
+}
+
+// namespaces reads a BadgerFish "@xmlns" object into declarations on
+// start, for the bindings not already in scope.
+func (x *xmlWriter) namespaces(start *xml.StartElement, scope map[string]string) error {
+	if tok, err := x.d.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('{') {
+		return fmt.Errorf("xmljson: @xmlns of %s is not an object", start.Name.Local)
+	}
+	for x.d.More() {
+		prefix, err := x.key()
+		if err != nil {
+			return err
+		}
+		tok, err := x.d.Token()
+		if err != nil {
+			return err
+		}
+		uri, ok := tok.(string)
+		if !ok {
+			return fmt.Errorf("xmljson: @xmlns of %s binds %s to a non-string", start.Name.Local, prefix)
+		}
+		if prefix == "$" {
+			prefix = ""
+		} else if !isNCName(prefix) {
+			return fmt.Errorf("xmljson: @xmlns of %s binds %q, which is not a valid prefix", start.Name.Local, prefix)
+		}
+		if bound, ok := scope[prefix]; ok && bound == uri {
+			continue
+		}
+		scope[prefix] = uri
+		name := "xmlns"
+		if prefix != "" {
+			name += ":" + prefix
+		}
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: name}, Value: uri})
+	}
+	_, err := x.d.Token()
+	return err
+}
+
+// scalar returns the text of a JSON string, number, boolean or null.
+func scalar(tok json.Token) (string, bool) {
+	switch v := tok.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		if v {
+			return "true", true
+		}
+		return "false", true
+	case nil:
+		return "", true
+	}
+	return "", false
+}
+
+// isQName reports whether s is a qualified name: an NCName, optionally
+// with an NCName prefix.
+func isQName(s string) bool {
+	if prefix, local, ok := strings.Cut(s, ":"); ok {
+		return isNCName(prefix) && isNCName(local)
+	}
+	return isNCName(s)
+}
+
+// isNCName reports whether s is an XML name without a colon.
+func isNCName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case unicode.IsLetter(r) || r == '_':
+		case i > 0 && (unicode.IsDigit(r) || unicode.IsMark(r) || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package xmljson_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/goxpp/v2/xmljson"
+)
+
+func write(t *testing.T, js string, opts xmljson.Options) string {
+	t.Helper()
+	var out bytes.Buffer
+	if err := xmljson.Write(&out, strings.NewReader(js), opts); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		opts     xmljson.Options
+		js, want string
+	}{
+		{
+			xmljson.Options{},
+			`{"alice":{"@xmlns":{"$":"urn:a","c":"urn:c"},"@id":7,"bob":[{"$":"x<y"},{}],"c:d":{"@xmlns":{"$":"urn:a","c":"urn:c"},"$":true}}}`,
+			`<alice xmlns="urn:a" xmlns:c="urn:c" id="7"><bob>x&lt;y</bob><bob></bob><c:d>true</c:d></alice>`,
+		},
+		{
+			xmljson.Options{Convention: xmljson.Parker},
+			`{"n":-1.5e3,"item":[1,null],"g":{"s":"a&b"}}`,
+			`<root><n>-1.5e3</n><item>1</item><item></item><g><s>a&amp;b</s></g></root>`,
+		},
+		{
+			xmljson.Options{Convention: xmljson.Parker, Root: "doc"},
+			`"text"`,
+			`<doc>text</doc>`,
+		},
+		{
+			xmljson.Options{Convention: xmljson.Attributes},
+			`{"rss":{"@version":"2.0","link":{"@href":"http://a/","#text":"home"},"item":[{"title":"One"},"Two"]}}`,
+			`<rss version="2.0"><link href="http://a/">home</link><item><title>One</title></item><item>Two</item></rss>`,
+		},
+	}
+	for _, tt := range tests {
+		if got := write(t, tt.js, tt.opts); got != tt.want {
+			t.Errorf("Write(%s):\ngot  %s\nwant %s", tt.js, got, tt.want)
+		}
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	doc := `<alice xmlns="http://some-namespace" xmlns:charlie="http://some-other-namespace" id="1">
+<bob>david</bob><bob>eve &amp; "frank"</bob><charlie:edgar>frank</charlie:edgar><empty/>
+</alice>`
+	for _, conv := range []xmljson.Convention{xmljson.BadgerFish, xmljson.Parker, xmljson.Attributes} {
+		opts := xmljson.Options{Convention: conv, Root: "alice"}
+		js := convert(t, doc, opts)
+		if again := convert(t, write(t, js, opts), opts); again != js {
+			t.Errorf("convention %d:\ngot  %s\nwant %s", conv, again, js)
+		}
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	tests := []struct {
+		conv xmljson.Convention
+		js   string
+	}{
+		{xmljson.BadgerFish, `["a"]`},
+		{xmljson.BadgerFish, `{}`},
+		{xmljson.BadgerFish, `{"a":{},"b":{}}`},
+		{xmljson.BadgerFish, `{"a":{"b":{},"@c":"late"}}`},
+		{xmljson.BadgerFish, `{"a":{"@c":{}}}`},
+		{xmljson.Parker, `{"a":[[1]]}`},
+		{xmljson.Attributes, `{"a":{"#text":[]}}`},
+		{xmljson.BadgerFish, `{"a":{`},
+		{xmljson.BadgerFish, `{"a b":{"<x":"y"}}`},
+		{xmljson.Parker, `{"a":{"<x":"y"}}`},
+		{xmljson.Attributes, `{"a":{"@x y":"1"}}`},
+		{xmljson.Attributes, `{"a":{"@x\"=\"":"1"}}`},
+		{xmljson.BadgerFish, `{"a:b:c":{}}`},
+		{xmljson.BadgerFish, `{"a":{"@xmlns":{"p q":"urn:x"}}}`},
+		{xmljson.Parker, `{"1a":null}`},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := xmljson.Write(&out, strings.NewReader(tt.js), xmljson.Options{Convention: tt.conv}); err == nil {
+			t.Errorf("Write(%s) = nil, want an error", tt.js)
+		}
+	}
+}
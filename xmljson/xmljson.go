@@ -0,0 +1,506 @@
+// Package xmljson converts XML to JSON and back, streaming between an
+// xpp.Parser and an io.Writer under one of several conventions: Convert
+// writes JSON from a parser, and Write reads it back into XML.
+//
+// Elements become object members keyed by their qualified names, using the
+// prefixes the parser reports through PrefixForURI. Sibling elements with
+// the same name become an array, whether or not they are adjacent. Because
+// a later sibling may share a name, the converter holds the serialized
+// children of each open element, grouped by name, until the element
+// closes. Once they outgrow Options.MaxHeld it writes them out and streams
+// the rest. A name that repeats after its members were written is an
+// error, unless its array is still open: the repeat directly follows and
+// the name was already repeated or is listed in Options.ForceArray, which
+// is how to stream a long run of large elements such as feed entries.
+package xmljson
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	xpp "github.com/mmcdole/goxpp/v2"
+)
+
+// Convention selects how elements, attributes and text map to JSON.
+type Convention int
+
+const (
+	// BadgerFish maps every element to an object: text in "$",
+	// attributes as "@name" and the namespaces in scope in "@xmlns",
+	// keyed by prefix with "$" for the default namespace. The root
+	// element is the single member of the top-level object.
+	BadgerFish Convention = iota
+	// Parker drops attributes and the root element's name: an element
+	// with children is an object of them, with its own text discarded;
+	// one with only text is that text as a JSON number or boolean where
+	// it reads as one, else a string; an empty one is null.
+	Parker
+	// Attributes maps an element with neither attributes nor children to
+	// its text as a string, and any other to an object with attributes as
+	// "@name" and non-whitespace text in "#text". The root element is the
+	// single member of the top-level object.
+	Attributes
+)
+
+// Options configures Convert and Write.
+type Options struct {
+	Convention Convention
+	// ForceArray names the elements, as qualified in the output, that are
+	// always arrays, even when they occur once. Write ignores it.
+	ForceArray []string
+	// Root names the root element Write creates under Parker, which does
+	// not record it; "root" if empty. Convert ignores it.
+	Root string
+	// MaxHeld bounds the bytes of JSON Convert holds per open element
+	// while it waits to see whether a child's name repeats; 64 KiB if
+	// zero. Write ignores it.
+	MaxHeld int
+}
+
+// Convert writes the element at the cursor as JSON to w, leaving the
+// parser on its EndTag. If the parser is not on a StartTag it first
+// advances to the next one, skipping the prolog. The output ends with a
+// newline.
+func Convert(w io.Writer, p *xpp.Parser, opts Options) error {
+	if p.Event() != xpp.StartTag {
+		if _, err := p.NextTag(); err != nil {
+			return err
+		}
+		if err := p.Expect(xpp.StartTag, "*"); err != nil {
+			return err
+		}
+	}
+	c := &converter{p: p, opts: opts, force: map[string]bool{}}
+	for _, name := range opts.ForceArray {
+		c.force[name] = true
+	}
+	ew := &errWriter{w: w}
+	if opts.Convention == Parker {
+		if err := c.value(ew); err != nil {
+			return err
+		}
+	} else {
+		ew.WriteString("{")
+		writeString(ew, c.name())
+		ew.WriteString(":")
+		if err := c.value(ew); err != nil {
+			return err
+		}
+		ew.WriteString("}")
+	}
+	ew.WriteString("\n")
+	return ew.err
+}
+
+type converter struct {
+	p     *xpp.Parser
+	opts  Options
+	force map[string]bool
+}
+
+// name returns the current element's qualified name.
+func (c *converter) name() string {
+	return qualify(c.p, c.p.Space(), c.p.Name())
+}
+
+func qualify(p *xpp.Parser, space, local string) string {
+	switch space {
+	case "":
+		return local
+	case xmlNS:
+		return "xml:" + local
+	}
+	prefix, ok := p.PrefixForURI(space)
+	if !ok {
+		// encoding/xml leaves an unbound prefix in place of the URI.
+		prefix = space
+	}
+	if prefix == "" {
+		return local
+	}
+	return prefix + ":" + local
+}
+
+const xmlNS = "http://www.w3.org/XML/1998/namespace"
+
+// object writes the members of a JSON object, opening it on the first
+// member unless it was opened already.
+type object struct {
+	w       *errWriter
+	open    bool
+	members int
+	c       *converter
+
+	// pending holds the serialized child elements not yet written, grouped
+	// by name in order of first occurrence, because a later sibling may
+	// share the name. size counts their bytes.
+	pending []*member
+	size    int
+	// written records the names whose members are already in the output.
+	written map[string]bool
+	// streaming is the member last written straight to w, after the held
+	// children outgrew Options.MaxHeld; its array stays open while
+	// siblings of its name follow.
+	streaming *member
+}
+
+type member struct {
+	name   string
+	values []*bytes.Buffer
+	array  bool
+}
+
+func (o *object) begin() {
+	if !o.open {
+		o.w.WriteString("{")
+		o.open = true
+	}
+}
+
+func (o *object) key(k string) {
+	o.begin()
+	if o.members > 0 {
+		o.w.WriteString(",")
+	}
+	o.members++
+	writeString(o.w, k)
+	o.w.WriteString(":")
+}
+
+// write writes m's key and the values held so far, leaving an array open.
+func (o *object) write(m *member) {
+	o.key(m.name)
+	if m.array {
+		o.w.WriteString("[")
+	}
+	for i, v := range m.values {
+		if i > 0 {
+			o.w.WriteString(",")
+		}
+		o.w.Write(v.Bytes())
+	}
+	if o.written == nil {
+		o.written = map[string]bool{}
+	}
+	o.written[m.name] = true
+}
+
+// flush writes the held children, or closes the array in progress.
+func (o *object) flush() {
+	if s := o.streaming; s != nil && s.array {
+		o.w.WriteString("]")
+	}
+	o.streaming = nil
+	for _, m := range o.pending {
+		o.write(m)
+		if m.array {
+			o.w.WriteString("]")
+		}
+	}
+	o.pending, o.size = nil, 0
+}
+
+// spill writes the held children once they outgrow the bound, leaving
+// cur, whose last value is still being converted, to stream from there.
+func (o *object) spill(cur *member) {
+	for _, m := range o.pending {
+		if m != cur {
+			o.write(m)
+			if m.array {
+				o.w.WriteString("]")
+			}
+		}
+	}
+	o.write(cur)
+	o.pending, o.size, o.streaming = nil, 0, cur
+}
+
+// child converts the child element at the cursor into o.
+func (c *converter) child(o *object) error {
+	name := c.name()
+	if s := o.streaming; s != nil {
+		if s.name == name && s.array {
+			o.w.WriteString(",")
+			return c.value(o.w)
+		}
+		if s.array {
+			o.w.WriteString("]")
+		}
+		o.streaming = nil
+	}
+	if o.written[name] {
+		return fmt.Errorf("xmljson: element %s repeats after it was written, its siblings having outgrown Options.MaxHeld (%d bytes)", name, c.maxHeld())
+	}
+	var m *member
+	for _, pm := range o.pending {
+		if pm.name == name {
+			m = pm
+			break
+		}
+	}
+	if m == nil {
+		m = &member{name: name, array: c.force[name]}
+		o.pending = append(o.pending, m)
+	} else {
+		m.array = true
+	}
+	h := &heldWriter{o: o, m: m, buf: &bytes.Buffer{}}
+	m.values = append(m.values, h.buf)
+	if err := c.value(&errWriter{w: h}); err != nil {
+		return err
+	}
+	return o.w.err
+}
+
+// heldWriter holds a child's value in its member until the object's held
+// children outgrow the bound, then writes through.
+type heldWriter struct {
+	o      *object
+	m      *member
+	buf    *bytes.Buffer
+	direct bool
+}
+
+func (h *heldWriter) Write(b []byte) (int, error) {
+	if h.direct {
+		h.o.w.Write(b)
+		return len(b), h.o.w.err
+	}
+	h.buf.Write(b)
+	h.o.size += len(b)
+	if h.o.size > h.o.c.maxHeld() {
+		h.o.spill(h.m)
+		h.direct = true
+	}
+	return len(b), h.o.w.err
+}
+
+func (c *converter) maxHeld() int {
+	if c.opts.MaxHeld > 0 {
+		return c.opts.MaxHeld
+	}
+	return defaultMaxHeld
+}
+
+const defaultMaxHeld = 64 << 10
+
+// value writes the JSON value of the element at the cursor, consuming it
+// through its EndTag.
+func (c *converter) value(w *errWriter) error {
+	p := c.p
+	o := &object{w: w, c: c}
+	conv := c.opts.Convention
+
+	var attrs []xmlAttr
+	for _, a := range p.Attrs() {
+		if a.Name.Space == "xmlns" || (a.Name.Space == "" && a.Name.Local == "xmlns") {
+			continue
+		}
+		attrs = append(attrs, xmlAttr{qualify(p, a.Name.Space, a.Name.Local), a.Value})
+	}
+	if conv != Parker {
+		for _, a := range attrs {
+			o.key("@" + a.name)
+			writeString(w, a.value)
+		}
+	}
+	if conv == BadgerFish {
+		o.begin()
+		if ns := p.Namespaces(); len(ns) > 0 {
+			writeNamespaces(o, ns)
+		}
+	}
+
+	var text strings.Builder
+	children := false
+	for {
+		t, err := p.Next()
+		if err != nil {
+			return err
+		}
+		switch t {
+		case xpp.Text:
+			text.WriteString(p.Text())
+			continue
+		case xpp.StartTag:
+			children = true
+			if err := c.child(o); err != nil {
+				return err
+			}
+			continue
+		case xpp.EndTag:
+		default:
+			return p.Expect(xpp.EndTag, "*")
+		}
+		break
+	}
+	o.flush()
+
+	s := text.String()
+	if children && strings.TrimSpace(s) == "" {
+		s = ""
+	}
+	switch {
+	case conv == BadgerFish:
+		if s != "" {
+			o.key("$")
+			writeString(w, s)
+		}
+	case conv == Parker && !children:
+		if s == "" {
+			w.WriteString("null")
+		} else {
+			writeScalar(w, s)
+		}
+		return w.err
+	case conv == Attributes && !o.open:
+		writeString(w, s)
+		return w.err
+	case conv == Attributes && strings.TrimSpace(s) != "":
+		o.key("#text")
+		writeString(w, s)
+	}
+	o.begin()
+	w.WriteString("}")
+	return w.err
+}
+
+type xmlAttr struct {
+	name, value string
+}
+
+func writeNamespaces(o *object, ns map[string]string) {
+	prefixes := make([]string, 0, len(ns))
+	for prefix := range ns {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	o.key("@xmlns")
+	o.w.WriteString("{")
+	for i, prefix := range prefixes {
+		if i > 0 {
+			o.w.WriteString(",")
+		}
+		key := prefix
+		if key == "" {
+			key = "$"
+		}
+		writeString(o.w, key)
+		o.w.WriteString(":")
+		writeString(o.w, ns[prefix])
+	}
+	o.w.WriteString("}")
+}
+
+// writeScalar writes s as a JSON number or boolean if it is exactly one.
+func writeScalar(w *errWriter, s string) {
+	if s == "true" || s == "false" || isNumber(s) {
+		w.WriteString(s)
+		return
+	}
+	writeString(w, s)
+}
+
+// isNumber reports whether s matches JSON's number grammar.
+func isNumber(s string) bool {
+	digits := func(i int) int {
+		for i < len(s) && '0' <= s[i] && s[i] <= '9' {
+			i++
+		}
+		return i
+	}
+	i := 0
+	if i < len(s) && s[i] == '-' {
+		i++
+	}
+	switch {
+	case i < len(s) && s[i] == '0':
+		i++
+	case i < len(s) && '1' <= s[i] && s[i] <= '9':
+		i = digits(i)
+	default:
+		return false
+	}
+	if i < len(s) && s[i] == '.' {
+		j := digits(i + 1)
+		if j == i+1 {
+			return false
+		}
+		i = j
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		i++
+		if i < len(s) && (s[i] == '+' || s[i] == '-') {
+			i++
+		}
+		j := digits(i)
+		if j == i {
+			return false
+		}
+		i = j
+	}
+	return i == len(s)
+}
+
+// writeString writes s as a JSON string. Unlike encoding/json it leaves
+// <, > and & alone, which XML content is full of.
+func writeString(w *errWriter, s string) {
+	const hex = "0123456789abcdef"
+	buf := make([]byte, 0, len(s)+2)
+	buf = append(buf, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			buf = append(buf, '\\', c)
+		case c == '\n':
+			buf = append(buf, '\\', 'n')
+		case c == '\r':
+			buf = append(buf, '\\', 'r')
+		case c == '\t':
+			buf = append(buf, '\\', 't')
+		case c < 0x20:
+			buf = append(buf, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+		case c < utf8.RuneSelf:
+			buf = append(buf, c)
+		default:
+			r, size := utf8.DecodeRuneInString(s[i:])
+			switch {
+			case r == utf8.RuneError && size == 1:
+				buf = append(buf, `\ufffd`...)
+			case r == '\u2028' || r == '\u2029':
+				buf = append(buf, '\\', 'u', '2', '0', '2', hex[r&0xF])
+			default:
+				buf = append(buf, s[i:i+size]...)
+			}
+			i += size
+			continue
+		}
+		i++
+	}
+	buf = append(buf, '"')
+	w.Write(buf)
+}
+
+// errWriter keeps the first write error and drops later writes.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) Write(b []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	n, err := e.w.Write(b)
+	e.err = err
+	return n, err
+}
+
+func (e *errWriter) WriteString(s string) {
+	e.Write([]byte(s))
+}
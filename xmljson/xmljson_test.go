@@ -0,0 +1,168 @@
+package xmljson_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	xpp "github.com/mmcdole/goxpp/v2"
+	"github.com/mmcdole/goxpp/v2/xmljson"
+)
+
+func newParser(doc string) *xpp.Parser {
+	d := xml.NewDecoder(bytes.NewReader([]byte(doc)))
+	d.Strict = false
+	return xpp.New(d)
+}
+
+func convert(t *testing.T, doc string, opts xmljson.Options) string {
+	t.Helper()
+	var out bytes.Buffer
+	p := newParser(doc)
+	if err := xmljson.Convert(&out, p, opts); err != nil {
+		t.Fatal(err)
+	}
+	if p.Event() != xpp.EndTag {
+		t.Fatalf("cursor = %s, want the root's EndTag", p.Event())
+	}
+	if !json.Valid(out.Bytes()) {
+		t.Fatalf("invalid JSON: %s", out.String())
+	}
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+func TestBadgerFish(t *testing.T) {
+	// The namespace example from the BadgerFish convention.
+	doc := `<?xml version="1.0"?>
+<alice xmlns="http://some-namespace" xmlns:charlie="http://some-other-namespace">
+  <bob>david</bob>
+  <charlie:edgar>frank</charlie:edgar>
+</alice>`
+	ns := `"@xmlns":{"$":"http://some-namespace","charlie":"http://some-other-namespace"}`
+	want := `{"alice":{` + ns + `,"bob":{` + ns + `,"$":"david"},"charlie:edgar":{` + ns + `,"$":"frank"}}}`
+	if got := convert(t, doc, xmljson.Options{}); got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+
+	doc = `<alice charlie="david"><bob>charlie</bob><bob>edgar</bob>text</alice>`
+	want = `{"alice":{"@charlie":"david","bob":[{"$":"charlie"},{"$":"edgar"}],"$":"text"}}`
+	if got := convert(t, doc, xmljson.Options{}); got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestParker(t *testing.T) {
+	doc := `<root a="ignored">
+  <name>x &amp; "y"</name>
+  <count>42</count><ratio>-1.5e3</ratio><ok>true</ok><zip>00501 </zip>
+  <empty/>
+  <item>1</item><item>2</item>
+  <group><item>only</item></group>
+</root>`
+	want := `{"name":"x & \"y\"","count":42,"ratio":-1.5e3,"ok":true,"zip":"00501 ","empty":null,"item":[1,2],"group":{"item":"only"}}`
+	if got := convert(t, doc, xmljson.Options{Convention: xmljson.Parker}); got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+
+	want = `{"name":"x & \"y\"","count":42,"ratio":-1.5e3,"ok":true,"zip":"00501 ","empty":null,"item":[1,2],"group":{"item":["only"]}}`
+	opts := xmljson.Options{Convention: xmljson.Parker, ForceArray: []string{"item"}}
+	if got := convert(t, doc, opts); got != want {
+		t.Fatalf("ForceArray:\ngot  %s\nwant %s", got, want)
+	}
+
+	doc = `<root><a>"12"</a><b>null</b><c>012</c><d>1.</d><e>-0.5E+2</e><f>True</f></root>`
+	want = `{"a":"\"12\"","b":"null","c":"012","d":"1.","e":-0.5E+2,"f":"True"}`
+	if got := convert(t, doc, xmljson.Options{Convention: xmljson.Parker}); got != want {
+		t.Fatalf("scalars:\ngot  %s\nwant %s", got, want)
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	doc := `<rss version="2.0" xmlns:dc="http://purl.org/dc/elements/1.1/"><channel>
+	<title>Feed</title>
+	<link href="http://a/" rel="self"/>
+	<dc:creator xml:lang="en">me</dc:creator>
+	<item><title>One</title></item>
+	<item><title>Two</title></item>
+	<item><title>Three</title></item>
+	<note>a<b/>c</note>
+</channel></rss>`
+	want := `{"rss":{"@version":"2.0","channel":{"title":"Feed","link":{"@href":"http://a/","@rel":"self"},` +
+		`"dc:creator":{"@xml:lang":"en","#text":"me"},"item":[{"title":"One"},{"title":"Two"},{"title":"Three"}],` +
+		`"note":{"b":"","#text":"ac"}}}}`
+	if got := convert(t, doc, xmljson.Options{Convention: xmljson.Attributes}); got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestConvertEscaping(t *testing.T) {
+	got := convert(t, "<a>&lt;tag&gt; \t\u2028\\ </a>", xmljson.Options{Convention: xmljson.Attributes})
+	if want := `{"a":"<tag> \t\u2028\\ "}`; got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestConvertInterleaved(t *testing.T) {
+	doc := `<feed><link>1</link><title>t</title><link>2</link><entry/><link>3</link></feed>`
+	want := `{"feed":{"link":["1","2","3"],"title":"t","entry":""}}`
+	if got := convert(t, doc, xmljson.Options{Convention: xmljson.Attributes}); got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestConvertMaxHeld(t *testing.T) {
+	var doc strings.Builder
+	doc.WriteString("<rss><channel><title>t</title>")
+	for i := 0; i < 50; i++ {
+		doc.WriteString("<item>x</item>")
+	}
+	doc.WriteString("</channel></rss>")
+
+	// Past the bound, the channel streams: its start is written before
+	// the parser reaches its end.
+	var out bytes.Buffer
+	p := newParser(doc.String())
+	if _, err := p.NextTag(); err != nil {
+		t.Fatal(err)
+	}
+	opts := xmljson.Options{Convention: xmljson.Attributes, MaxHeld: 64}
+	w := &watchWriter{w: &out, p: p}
+	if err := xmljson.Convert(w, p, opts); err != nil {
+		t.Fatal(err)
+	}
+	if !w.early {
+		t.Error("nothing was written before the channel closed")
+	}
+	want := `{"rss":{"channel":{"title":"t","item":[` + strings.Repeat(`"x",`, 49) + `"x"]}}}`
+	if got := strings.TrimSpace(out.String()); got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+
+	doc.Reset()
+	doc.WriteString("<feed><link>1</link>")
+	for i := 0; i < 40; i++ {
+		doc.WriteString("<entry>x</entry>")
+	}
+	doc.WriteString("<link>2</link></feed>")
+	p = newParser(doc.String())
+	if err := xmljson.Convert(&out, p, opts); err == nil || !strings.Contains(err.Error(), "link repeats") {
+		t.Fatalf("repeat after spill: err = %v", err)
+	}
+}
+
+// watchWriter records whether anything was written while the parser was
+// still inside the channel element.
+type watchWriter struct {
+	w     *bytes.Buffer
+	p     *xpp.Parser
+	early bool
+}
+
+func (w *watchWriter) Write(b []byte) (int, error) {
+	if w.p.Depth() >= 2 && w.p.Event() != xpp.EndTag {
+		w.early = true
+	}
+	return w.w.Write(b)
+}
@@ -9,12 +9,15 @@
 package xpp
 
 import (
+	"bytes"
+	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"net/url"
 	"strings"
+	"time"
 )
 
 // EventType identifies the kind of token the parser is positioned on.
@@ -33,6 +36,14 @@ const (
 	Comment
 	ProcessingInstruction
 	Directive
+	// CDSect is a CDATA section. NextToken reports it only for a parser
+	// from NewReader; encoding/xml alone does not distinguish CDATA, so
+	// other parsers report Text. Next reports it as Text; see IsCDATA.
+	CDSect
+	// EntityRef is a reference to an entity the decoder does not know,
+	// reported only with WithEntityRefs or WithEntityResolver. Name is the
+	// entity name. Next reports it as Text.
+	EntityRef
 )
 
 func (e EventType) String() string {
@@ -53,6 +64,10 @@ func (e EventType) String() string {
 		return "ProcessingInstruction"
 	case Directive:
 		return "Directive"
+	case CDSect:
+		return "CDSect"
+	case EntityRef:
+		return "EntityRef"
 	}
 	return fmt.Sprintf("EventType(%d)", int(e))
 }
@@ -63,17 +78,86 @@ const xmlNSURI = "http://www.w3.org/XML/1998/namespace"
 // the event or name the caller required. It is returned by Expect and
 // ExpectAll, and by the preconditions of NextTag, NextText, Skip and
 // DecodeElement. Want fields hold "*" where anything was acceptable.
+//
+// It matches ErrUnexpectedEvent with errors.Is, and also ErrUnexpectedEOF
+// when the document ended instead.
 type ExpectError struct {
 	WantEvent           EventType
 	WantSpace, WantName string
 	GotEvent            EventType
 	GotSpace, GotName   string
 	Offset              int64
+
+	// Expected lists every acceptable alternative, such as StartTag or
+	// EndTag for NextTag. The Want fields repeat its first entry.
+	Expected []Expected
+	// Path is the slash-separated path of qualified element names from
+	// the root to the current element, such as "/rss/channel/item".
+	// Without raw input (New) prefixes are reconstructed from namespaces.
+	Path string
+	// Line and Column locate Offset, counting from 1; Column counts bytes.
+	Line, Column int
+	// Snippet is the line of input around Offset, clipped to a few dozen
+	// bytes either side. It is only available from NewReader parsers.
+	Snippet string
 }
 
+// Expected is one acceptable parser position in an ExpectError.
+type Expected struct {
+	Event       EventType
+	Space, Name string
+}
+
+func (x Expected) String() string {
+	s := x.Event.String()
+	if x.Space != "*" && x.Space != "" {
+		s += " {" + x.Space + "}"
+	} else if x.Name != "*" && x.Name != "" {
+		s += " "
+	}
+	if x.Name != "*" && x.Name != "" {
+		s += x.Name
+	}
+	return s
+}
+
+// ErrUnexpectedEvent is matched by every *ExpectError.
+var ErrUnexpectedEvent = errors.New("xpp: unexpected event")
+
+// ErrUnexpectedEOF reports a document that ended inside an element a
+// method was reading, such as Skip's.
+var ErrUnexpectedEOF = errors.New("xpp: document ended")
+
 func (e *ExpectError) Error() string {
-	return fmt.Sprintf("xpp: expected space:%s name:%s event:%s but got space:%s name:%s event:%s at offset %d",
-		e.WantSpace, e.WantName, e.WantEvent, e.GotSpace, e.GotName, e.GotEvent, e.Offset)
+	expected := e.Expected
+	if len(expected) == 0 {
+		expected = []Expected{{e.WantEvent, e.WantSpace, e.WantName}}
+	}
+	want := make([]string, len(expected))
+	for i, x := range expected {
+		want[i] = x.String()
+	}
+	got := Expected{e.GotEvent, e.GotSpace, e.GotName}
+	if got.Name == "" {
+		got.Name = "*"
+	}
+	msg := fmt.Sprintf("xpp: expected %s but got %s", strings.Join(want, " or "), got)
+	if e.Path != "" {
+		msg += " in " + e.Path
+	}
+	if e.Line > 0 {
+		msg += fmt.Sprintf(" at line %d, column %d (offset %d)", e.Line, e.Column, e.Offset)
+	} else {
+		msg += fmt.Sprintf(" at offset %d", e.Offset)
+	}
+	if e.Snippet != "" {
+		msg += fmt.Sprintf(": %q", e.Snippet)
+	}
+	return msg
+}
+
+func (e *ExpectError) Is(target error) bool {
+	return target == ErrUnexpectedEvent || (target == ErrUnexpectedEOF && e.GotEvent == EndDocument)
 }
 
 // nsScope is one element's namespace scope: the full merged prefix -> URI
@@ -82,6 +166,18 @@ func (e *ExpectError) Error() string {
 type nsScope struct {
 	bindings map[string]string
 	decls    []nsDecl
+	// qname is the element's name as written, prefix included. It is only
+	// known when the parser owns its input (NewReader).
+	qname string
+	// preserve records xml:space="preserve" in effect for the element.
+	preserve bool
+	// lang and xmlSpace are the xml:lang and xml:space values in effect,
+	// set on the element or its nearest ancestor; hasLang and hasXMLSpace
+	// report whether any sets them.
+	lang, xmlSpace       string
+	hasLang, hasXMLSpace bool
+	// space and local name the element, for error paths.
+	space, local string
 }
 
 type nsDecl struct {
@@ -98,6 +194,7 @@ type Parser struct {
 	name  string
 	space string
 	text  string
+	cdata bool
 	attrs []xml.Attr
 	depth int
 
@@ -111,25 +208,114 @@ type Parser struct {
 	pendingPop bool
 	docEnded   bool
 	err        error
+
+	// src is the raw input when the parser owns it (NewReader). offsetAdj
+	// maps the current decoder's offsets to raw input offsets after a
+	// restart, and tokStart is the raw offset of the current token.
+	src       *source
+	offsetAdj int64
+	tokStart  int64
+	// tagEnd is the raw offset just past the current start tag, and
+	// written holds its specified attributes as written, parsed from src
+	// on first use; writtenDone records the attempt.
+	tagEnd      int64
+	written     []writtenAttr
+	writtenDone bool
+
+	recover   bool
+	recovered []*RecoveredError
+
+	entityRefs bool
+	resolver   EntityResolver
+	refOK      bool // the current EntityRef was resolved
+
+	// queue holds events split out of one decoder token, delivered by
+	// the following advancement calls.
+	queue []queued
+
+	doctype     *DocType
+	entityLimit int // WithDTDEntities; 0 when off
+	// expansion is how much longer than their input the tokens of a
+	// parser from New may still decode to, once budgeted is set by
+	// installing entities.
+	expansion int
+	budgeted  bool
+
+	dtdDefaults  bool
+	attrDefaults map[string][]attrDefault // element qname -> defaults
+	specified    int                      // attrs before the defaulted ones
+
+	procInst *ProcInst
+	xmlDecl  *XMLDecl
+
+	blocks map[string]bool // WithBlockElements; nil for the default
+
+	multiDoc   bool
+	inputEnded bool
+	pending    *pendingToken     // read ahead by NextDocument
+	entityBase map[string]string // d.Entity before WithDTDEntities installed any
+
+	streamHeader *xml.StartElement
+
+	feed *feedBuffer // input comes from a Feeder
+
+	recorder *Recorder
+	tape     *json.Decoder // events come from a Replay tape
+	tracer   Tracer
+	stats    stats
+}
+
+// queued is an event delivered from Parser.queue rather than the decoder.
+type queued struct {
+	event      EventType
+	name, text string
+	refOK      bool
 }
 
+// Option configures a Parser at construction.
+type Option func(*Parser)
+
 // New returns a parser reading from d. Configure strictness and charset
-// conversion on the decoder directly (d.Strict, d.CharsetReader); the parser
-// adds no configuration of its own.
-func New(d *xml.Decoder) *Parser {
-	return &Parser{decoder: d, event: StartDocument}
+// conversion on the decoder directly (d.Strict, d.CharsetReader); options
+// configure only the parser's own behavior.
+func New(d *xml.Decoder, opts ...Option) *Parser {
+	p := &Parser{decoder: d, event: StartDocument}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
 }
 
 // NextToken advances to the next raw token, including comments, processing
 // instructions and directives. The first call after the document ends
 // returns (EndDocument, nil); every call after that returns io.EOF. After a
 // decoder error or a failed DecodeElement the parser is poisoned and every
-// call returns that error; see Err.
+// call returns that error; see Err. WithRecovery turns syntax errors into
+// recorded, skipped regions instead. WithMultiDocument ends each document
+// when its root element closes; see NextDocument.
 func (p *Parser) NextToken() (EventType, error) {
+	var start time.Time
+	if p.tracer != nil {
+		start = time.Now()
+	}
+	event, err := p.nextToken()
+	if err == nil {
+		p.countEvent()
+		if p.recorder != nil {
+			p.recorder.record(p)
+		}
+	}
+	if p.tracer != nil {
+		p.trace("NextToken", start, err)
+	}
+	return event, err
+}
+
+func (p *Parser) nextToken() (EventType, error) {
 	if p.err != nil {
 		return p.event, p.err
 	}
-	if p.decoder == nil {
+	if p.decoder == nil && p.tape == nil {
 		p.err = errors.New("xpp: parser has no decoder; use New")
 		return p.event, p.err
 	}
@@ -137,28 +323,88 @@ func (p *Parser) NextToken() (EventType, error) {
 		return p.event, io.EOF
 	}
 
+	// A tape has the EndDocument recorded after each root element.
+	rootClosed := p.multiDoc && p.tape == nil && p.pendingPop && p.depth == 1
+	var mark feedMark
+	if p.feed != nil {
+		if !rootClosed && len(p.queue) == 0 && p.pending == nil && !p.feedReady(p.InputOffset()) {
+			return p.event, ErrNeedMoreInput
+		}
+		mark = p.feedMark()
+	}
 	p.applyPendingPop()
 	p.resetTokenState()
+	if rootClosed {
+		p.token = nil
+		p.event = EndDocument
+		p.docEnded = true
+		return p.event, nil
+	}
 
-	tok, err := p.decoder.Token()
-	if err != nil {
+	if len(p.queue) > 0 {
+		q := p.queue[0]
+		p.queue = p.queue[1:]
+		p.token = nil
+		p.event, p.name, p.text, p.refOK = q.event, q.name, q.text, q.refOK
+		return p.event, nil
+	}
+	if p.tape != nil {
+		return p.replayToken()
+	}
+
+	for {
+		var tok xml.Token
+		var err error
+		if p.pending != nil {
+			tok, err, p.tokStart = p.pending.tok, p.pending.err, p.pending.start
+			p.pending = nil
+		} else {
+			p.tokStart = p.InputOffset()
+			if p.src != nil {
+				p.src.release(p.tokStart)
+			}
+			start := time.Now()
+			tok, err = p.decoder.Token()
+			p.stats.decoderTime += time.Since(start)
+		}
+		if p.feed != nil && (errors.Is(err, ErrNeedMoreInput) || err == nil && p.textCut(tok)) {
+			return p.needMoreInput(&mark)
+		}
+		if err == nil && p.budgeted {
+			err = p.chargeExpansion(tok)
+		}
+		if err == nil {
+			p.token = xml.CopyToken(tok)
+			p.processToken(p.token)
+			return p.event, nil
+		}
+		if err != io.EOF && p.entityRefs && p.src != nil && p.splitUndeclared(err) {
+			return p.event, nil
+		}
+		if err != io.EOF && p.recover && p.src != nil {
+			var more bool
+			if more, err = p.recoverFrom(p.tokStart, err); more {
+				continue
+			}
+			if err == nil {
+				err = io.EOF
+			}
+		}
 		if err == io.EOF {
 			p.token = nil
 			p.event = EndDocument
 			p.docEnded = true
+			p.inputEnded = true
 			return p.event, nil
 		}
-		p.err = err
-		return p.event, err
+		p.err = p.parseError(err)
+		return p.event, p.err
 	}
-
-	p.token = xml.CopyToken(tok)
-	p.processToken(p.token)
-	return p.event, nil
 }
 
 // Next advances like NextToken but skips Comment, ProcessingInstruction and
-// Directive tokens.
+// Directive tokens, and reports CDATA sections and entity references as
+// Text. An unresolved entity reference reads as the literal reference.
 func (p *Parser) Next() (EventType, error) {
 	for {
 		event, err := p.NextToken()
@@ -168,6 +414,11 @@ func (p *Parser) Next() (EventType, error) {
 		switch event {
 		case Comment, ProcessingInstruction, Directive:
 			continue
+		case CDSect, EntityRef:
+			p.text = p.textValue()
+			p.name = ""
+			p.event = Text
+			return Text, nil
 		}
 		return event, nil
 	}
@@ -187,47 +438,36 @@ func (p *Parser) NextTag() (EventType, error) {
 		}
 	}
 	if t != StartTag && t != EndTag {
-		return t, p.expectErr(StartTag, "*", "*")
+		return t, p.expectAny(Expected{StartTag, "*", "*"}, Expected{EndTag, "*", "*"})
 	}
 	return t, nil
 }
 
 // NextText requires the parser to be on a StartTag, consumes the element's
-// text content, and leaves the parser on the matching EndTag.
+// text content, and leaves the parser on the matching EndTag. It is
+// NextTextWith with the zero TextPolicy.
 func (p *Parser) NextText() (string, error) {
-	if p.event != StartTag {
-		return "", p.expectErr(StartTag, "*", "*")
-	}
-
-	t, err := p.Next()
-	if err != nil {
-		return "", err
-	}
-
-	// The decoder emits a separate CharData token at every entity and CDATA
-	// boundary, so entity-heavy text arrives as many small fragments. Use a
-	// Builder to avoid quadratic string concatenation.
-	var sb strings.Builder
-	for t == Text {
-		sb.WriteString(p.text)
-		t, err = p.Next()
-		if err != nil {
-			return "", err
-		}
-	}
-	if t != EndTag {
-		return "", p.expectErr(EndTag, "*", "*")
-	}
-	return sb.String(), nil
+	return p.NextTextWith(TextPolicy{})
 }
 
 // Skip requires the parser to be on a StartTag and consumes tokens through
 // the matching end tag. It is iterative (a depth counter rather than
 // recursion) so deeply nested input can't overflow the goroutine stack.
 func (p *Parser) Skip() error {
+	if p.tracer == nil {
+		return p.skip()
+	}
+	start := time.Now()
+	err := p.skip()
+	p.trace("Skip", start, err)
+	return err
+}
+
+func (p *Parser) skip() error {
 	if p.event != StartTag {
 		return p.expectErr(StartTag, "*", "*")
 	}
+	from := p.InputOffset()
 	depth := 0
 	for {
 		tok, err := p.NextToken()
@@ -239,11 +479,13 @@ func (p *Parser) Skip() error {
 			depth++
 		case EndTag:
 			if depth == 0 {
+				p.stats.skippedSubtrees++
+				p.stats.skippedBytes += p.InputOffset() - from
 				return nil
 			}
 			depth--
 		case EndDocument:
-			return errors.New("xpp: document ended while skipping element")
+			return unexpectedEOF("skipping element")
 		}
 	}
 }
@@ -252,19 +494,44 @@ func (p *Parser) Skip() error {
 // element into v using encoding/xml. On success the cursor is left on the
 // element's end tag. On failure the decoder has stopped at an unknown
 // position inside the element, so the parser is poisoned: DecodeElement
-// returns the decoder's error and every later call returns the wrapped form.
+// returns the decoder's error, a syntax error as a *ParseError, and every
+// later call returns the wrapped form.
+//
+// If v implements Unmarshaler, such as a type with a method generated by
+// cmd/xppgen, DecodeElement calls UnmarshalXPP instead and returns its
+// error; that path reads through the cursor and does not poison the parser.
 func (p *Parser) DecodeElement(v any) error {
+	if p.tracer == nil {
+		return p.decodeElement(v)
+	}
+	start := time.Now()
+	err := p.decodeElement(v)
+	p.trace("DecodeElement", start, err)
+	return err
+}
+
+func (p *Parser) decodeElement(v any) error {
 	if p.err != nil {
 		return p.err
 	}
 	if p.event != StartTag {
 		return p.expectErr(StartTag, "*", "*")
 	}
+	if u, ok := v.(Unmarshaler); ok {
+		return u.UnmarshalXPP(p)
+	}
+	if p.decoder == nil {
+		return errors.New("xpp: DecodeElement needs a decoder; a replayed parser has none")
+	}
 
 	start := p.token.(xml.StartElement)
 	name, space := p.name, p.space
 
-	if err := p.decoder.DecodeElement(v, &start); err != nil {
+	began := time.Now()
+	err := p.decoder.DecodeElement(v, &start)
+	p.stats.decoderTime += time.Since(began)
+	if err != nil {
+		err = p.parseError(err)
 		p.err = fmt.Errorf("xpp: parser state desynced by DecodeElement error: %w", err)
 		return err
 	}
@@ -279,6 +546,10 @@ func (p *Parser) DecodeElement(v any) error {
 	p.name = name
 	p.space = space
 	p.pendingPop = true
+	p.countEvent()
+	if p.recorder != nil {
+		p.recorder.record(p)
+	}
 	return nil
 }
 
@@ -292,9 +563,25 @@ func (p *Parser) Name() string { return p.name }
 // Space returns the namespace URI of the current start or end tag.
 func (p *Parser) Space() string { return p.space }
 
-// Text returns the content of the current Text, Comment or Directive token.
+// Text returns the content of the current Text, CDSect, Comment or
+// Directive token. For an EntityRef it is the resolved replacement text,
+// or "" when the reference was not resolved.
 func (p *Parser) Text() string { return p.text }
 
+// textValue returns the character data the current token contributes to
+// its element's text, as Next reports it.
+func (p *Parser) textValue() string {
+	if p.event == EntityRef && !p.refOK {
+		return "&" + p.name + ";"
+	}
+	return p.text
+}
+
+// IsCDATA reports whether the current text came from a CDATA section. It
+// stays true when Next reports the section as Text, and is always false
+// for a parser from New.
+func (p *Parser) IsCDATA() bool { return p.cdata }
+
 // Depth returns the element nesting depth of the current token. An EndTag
 // reports the same depth as its matching StartTag; the root element is
 // depth 1.
@@ -306,6 +593,88 @@ func (p *Parser) Depth() int { return p.depth }
 // through Attribute see the modification).
 func (p *Parser) Attrs() []xml.Attr { return p.attrs }
 
+// QName returns the current element's name as written, prefix included,
+// on a StartTag or EndTag. It is only known when the parser owns its input
+// (NewReader) or replays a tape recorded from such a parser; otherwise it
+// is "".
+func (p *Parser) QName() string {
+	if (p.event != StartTag && p.event != EndTag) || len(p.nsStack) == 0 {
+		return ""
+	}
+	return p.nsStack[len(p.nsStack)-1].qname
+}
+
+// AttrQName returns the name of Attrs()[i] on the current StartTag as
+// written, prefix included. Like QName it is known for written attributes
+// only when the parser owns its input, and it is also known for those
+// supplied by WithDTDDefaults; otherwise it is "".
+func (p *Parser) AttrQName(i int) string {
+	if p.event != StartTag || i < 0 || i >= len(p.attrs) {
+		return ""
+	}
+	if written := p.writtenAttrs(); i < len(written) {
+		return written[i].qname
+	}
+	if i >= p.specified {
+		return p.defaultQName(p.attrs[i].Name)
+	}
+	return ""
+}
+
+// NormalizedAttr returns the value of Attrs()[i] on the current StartTag
+// after XML attribute-value normalization, which encoding/xml does not
+// apply: a literal tab, newline or carriage return becomes a space, while
+// one written as a character reference is kept, and for an attribute the
+// internal subset declares with a type other than CDATA, runs of spaces
+// collapse to one and leading and trailing spaces are dropped. Telling
+// literal whitespace from references takes the raw input, so for a parser
+// that does not own its input the value is returned as decoded.
+func (p *Parser) NormalizedAttr(i int) string {
+	if p.event != StartTag || i < 0 || i >= len(p.attrs) {
+		return ""
+	}
+	if written := p.writtenAttrs(); i < len(written) {
+		return written[i].value
+	}
+	return p.attrs[i].Value
+}
+
+// writtenAttr is an attribute as written: its qualified name and its
+// normalized value.
+type writtenAttr struct {
+	qname, value string
+}
+
+// writtenAttrs returns the current start tag's attributes as written, or
+// nil when the raw input is not available or does not match the decoded
+// attributes.
+func (p *Parser) writtenAttrs() []writtenAttr {
+	if p.writtenDone || p.event != StartTag {
+		return p.written
+	}
+	p.writtenDone = true
+	if p.src == nil {
+		return nil
+	}
+	names, literals, ok := splitAttrs(p.src.bytes(p.tokStart, p.tagEnd))
+	if !ok || len(names) != p.specified {
+		return nil
+	}
+	written := make([]writtenAttr, len(names))
+	for i, name := range names {
+		local := name
+		if _, after, ok := strings.Cut(name, ":"); ok {
+			local = after
+		}
+		if local != p.attrs[i].Name.Local {
+			return nil
+		}
+		written[i] = writtenAttr{name, p.normalizeAttr(literals[i], p.declaredCDATA(name))}
+	}
+	p.written = written
+	return written
+}
+
 // Attribute returns the value of the named attribute on the current
 // StartTag, or "" if absent. Matching is exact and prefers an un-namespaced
 // attribute; a namespaced attribute is returned only when no plain one
@@ -335,9 +704,10 @@ func (p *Parser) IsWhitespace() bool { return strings.TrimSpace(p.text) == "" }
 // position.
 func (p *Parser) InputOffset() int64 {
 	if p.decoder == nil {
-		return 0
+		// A replayed parser keeps the recorded offset here.
+		return p.offsetAdj
 	}
-	return p.decoder.InputOffset()
+	return p.decoder.InputOffset() + p.offsetAdj
 }
 
 // Err returns the sticky error, or nil while the parser is healthy. It is
@@ -360,11 +730,7 @@ func (p *Parser) ExpectAll(event EventType, space, name string) error {
 		(name == "*" || strings.EqualFold(p.name, name)) {
 		return nil
 	}
-	return &ExpectError{
-		WantEvent: event, WantSpace: space, WantName: name,
-		GotEvent: p.event, GotSpace: p.space, GotName: p.name,
-		Offset: p.InputOffset(),
-	}
+	return p.expectErr(event, space, name)
 }
 
 // Namespaces returns the prefix -> URI bindings in scope for the current
@@ -400,6 +766,25 @@ func (p *Parser) PrefixForURI(uri string) (prefix string, ok bool) {
 	return "", false
 }
 
+// prefixFor returns a prefix bound to uri in the scope, preferring the
+// default namespace and then the first prefix in sort order. An unbound
+// prefix, which encoding/xml leaves in place of the URI, is returned as is.
+func (sc *nsScope) prefixFor(uri string) string {
+	if uri == "" || sc.bindings[""] == uri {
+		return ""
+	}
+	prefix, found := "", false
+	for k, v := range sc.bindings {
+		if v == uri && k != "" && (!found || k < prefix) {
+			prefix, found = k, true
+		}
+	}
+	if !found {
+		return uri
+	}
+	return prefix
+}
+
 func (p *Parser) currentBinding(prefix string) (string, bool) {
 	if n := len(p.nsStack); n > 0 {
 		uri, ok := p.nsStack[n-1].bindings[prefix]
@@ -420,15 +805,45 @@ func (p *Parser) BaseURL() *url.URL {
 	return nil
 }
 
+// Lang returns the xml:lang in effect for the current element, set on it
+// or its nearest ancestor; ok is false when none sets one.
+func (p *Parser) Lang() (lang string, ok bool) {
+	if n := len(p.nsStack); n > 0 {
+		return p.nsStack[n-1].lang, p.nsStack[n-1].hasLang
+	}
+	return "", false
+}
+
+// XMLSpace returns the xml:space value in effect for the current element,
+// as written on it or its nearest ancestor; ok is false when none sets
+// one.
+func (p *Parser) XMLSpace() (value string, ok bool) {
+	if n := len(p.nsStack); n > 0 {
+		return p.nsStack[n-1].xmlSpace, p.nsStack[n-1].hasXMLSpace
+	}
+	return "", false
+}
+
 func (p *Parser) processToken(t xml.Token) {
 	switch tt := t.(type) {
 	case xml.StartElement:
 		p.depth++
 		p.attrs = tt.Attr
+		p.specified = len(tt.Attr)
 		p.name = tt.Name.Local
 		p.space = tt.Name.Space
 		p.event = StartTag
 		p.pushNamespaces(tt)
+		if p.src != nil {
+			p.tagEnd = p.InputOffset()
+			p.nsStack[len(p.nsStack)-1].qname = rawName(p.src.bytes(p.tokStart, p.tagEnd))
+		}
+		if p.attrDefaults != nil {
+			p.applyAttrDefaults()
+			tt.Attr = p.attrs
+			p.token = tt
+		}
+		p.pushSpace()
 		p.pushBase()
 	case xml.EndElement:
 		p.name = tt.Name.Local
@@ -438,15 +853,33 @@ func (p *Parser) processToken(t xml.Token) {
 	case xml.CharData:
 		p.text = string(tt)
 		p.event = Text
+		if p.src != nil && bytes.HasPrefix(p.src.bytes(p.tokStart, p.tokStart+9), []byte("<![CDATA[")) {
+			p.event = CDSect
+			p.cdata = true
+		} else if p.entityRefs && p.src != nil {
+			// A non-strict decoder passes undeclared references through
+			// as literal text; split them out of the raw input.
+			raw := p.src.bytes(p.tokStart, p.InputOffset())
+			if bytes.IndexByte(raw, '&') >= 0 {
+				if pieces, ok := p.splitRefs(raw); ok && (len(pieces) > 1 || len(pieces) == 1 && pieces[0].event == EntityRef) {
+					p.deliver(pieces)
+				}
+			}
+		}
 	case xml.Comment:
 		p.text = string(tt)
 		p.event = Comment
 	case xml.ProcInst:
 		p.text = fmt.Sprintf("%s %s", tt.Target, string(tt.Inst))
 		p.event = ProcessingInstruction
+		p.procInst = &ProcInst{Target: tt.Target, Inst: string(tt.Inst)}
+		if tt.Target == "xml" && p.xmlDecl == nil {
+			p.processXMLDecl(p.procInst)
+		}
 	case xml.Directive:
 		p.text = string(tt)
 		p.event = Directive
+		p.processDocType(p.text)
 	}
 }
 
@@ -469,6 +902,11 @@ func (p *Parser) resetTokenState() {
 	p.name = ""
 	p.space = ""
 	p.text = ""
+	p.cdata = false
+	p.refOK = false
+	p.specified = 0
+	p.written, p.writtenDone = nil, false
+	p.procInst = nil
 }
 
 func (p *Parser) pushNamespaces(t xml.StartElement) {
@@ -491,7 +929,7 @@ func (p *Parser) pushNamespaces(t xml.StartElement) {
 			decls = append(decls, d)
 		}
 	}
-	p.nsStack = append(p.nsStack, nsScope{bindings: merged, decls: decls})
+	p.nsStack = append(p.nsStack, nsScope{bindings: merged, decls: decls, space: t.Name.Space, local: t.Name.Local})
 }
 
 func (p *Parser) pushBase() {
@@ -525,9 +963,61 @@ func (p *Parser) pushBase() {
 }
 
 func (p *Parser) expectErr(event EventType, space, name string) *ExpectError {
-	return &ExpectError{
-		WantEvent: event, WantSpace: space, WantName: name,
+	return p.expectAny(Expected{event, space, name})
+}
+
+// expectAny reports the current position against the acceptable
+// alternatives.
+func (p *Parser) expectAny(expected ...Expected) *ExpectError {
+	e := &ExpectError{
+		WantEvent: expected[0].Event, WantSpace: expected[0].Space, WantName: expected[0].Name,
 		GotEvent: p.event, GotSpace: p.space, GotName: p.name,
-		Offset: p.InputOffset(),
+		Offset:   p.InputOffset(),
+		Expected: expected,
+		Path:     p.path(),
+	}
+	e.Line, e.Column = p.position(e.Offset)
+	if p.src != nil {
+		e.Snippet, _ = p.src.excerpt(e.Offset)
+	}
+	if p.tracer != nil {
+		p.trace("Expect", time.Time{}, e)
+	}
+	return e
+}
+
+// unexpectedEOF reports the document ending while doing something.
+func unexpectedEOF(doing string) error {
+	return fmt.Errorf("%w while %s", ErrUnexpectedEOF, doing)
+}
+
+// path returns the slash-separated qualified names of the open elements.
+func (p *Parser) path() string {
+	var sb strings.Builder
+	for _, sc := range p.nsStack {
+		sb.WriteByte('/')
+		if sc.qname != "" {
+			sb.WriteString(sc.qname)
+			continue
+		}
+		if prefix := sc.prefixFor(sc.space); prefix != "" {
+			sb.WriteString(prefix)
+			sb.WriteByte(':')
+		}
+		sb.WriteString(sc.local)
+	}
+	return sb.String()
+}
+
+// position returns the line and byte column of raw offset off. Without
+// raw input it is the decoder's position, which is only exact for the
+// current offset.
+func (p *Parser) position(off int64) (line, col int) {
+	if p.src != nil {
+		return p.src.pos(off)
+	}
+	if p.decoder == nil {
+		return 0, 0
 	}
+	return p.decoder.InputPos()
 }
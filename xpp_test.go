@@ -12,9 +12,14 @@ import (
 )
 
 func newParser(doc string) *xpp.Parser {
+	return newParserWith(doc)
+}
+
+// newParserWith is newParser with options.
+func newParserWith(doc string, opts ...xpp.Option) *xpp.Parser {
 	d := xml.NewDecoder(bytes.NewReader([]byte(doc)))
 	d.Strict = false
-	return xpp.New(d)
+	return xpp.New(d, opts...)
 }
 
 // advanceTo positions the parser on the first StartTag with the given local
@@ -45,6 +50,8 @@ func TestEventTypeString(t *testing.T) {
 		xpp.Comment:               "Comment",
 		xpp.ProcessingInstruction: "ProcessingInstruction",
 		xpp.Directive:             "Directive",
+		xpp.CDSect:                "CDSect",
+		xpp.EntityRef:             "EntityRef",
 		xpp.EventType(99):         "EventType(99)",
 	}
 	for e, want := range cases {
@@ -609,3 +616,163 @@ func TestIsWhitespace(t *testing.T) {
 		t.Fatalf("event %v IsWhitespace %v, want whitespace Text", p.Event(), p.IsWhitespace())
 	}
 }
+
+func TestCDSectEvents(t *testing.T) {
+	doc := `<root>a &amp; b<![CDATA[<p>x</p>]]>c</root>`
+	p := xpp.NewReader(strings.NewReader(doc))
+	advanceTo(t, p, "root")
+
+	type step struct {
+		event xpp.EventType
+		text  string
+		cdata bool
+	}
+	want := []step{
+		{xpp.Text, "a & b", false},
+		{xpp.CDSect, "<p>x</p>", true},
+		{xpp.Text, "c", false},
+	}
+	for i, w := range want {
+		tok, err := p.NextToken()
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if tok != w.event || p.Text() != w.text || p.IsCDATA() != w.cdata {
+			t.Fatalf("step %d: %v %q cdata=%v, want %v %q cdata=%v",
+				i, tok, p.Text(), p.IsCDATA(), w.event, w.text, w.cdata)
+		}
+	}
+}
+
+func TestCDSectMergedByNext(t *testing.T) {
+	doc := `<root><a><![CDATA[x]]></a><b>1<![CDATA[&2]]>3</b></root>`
+	p := xpp.NewReader(strings.NewReader(doc))
+	advanceTo(t, p, "a")
+
+	tok, err := p.Next()
+	if err != nil || tok != xpp.Text || p.Event() != xpp.Text || !p.IsCDATA() {
+		t.Fatalf("Next = %v (%v) IsCDATA %v, want Text from CDATA", tok, err, p.IsCDATA())
+	}
+
+	advanceTo(t, p, "b")
+	text, err := p.NextText()
+	if err != nil || text != "1&23" {
+		t.Fatalf("NextText = %q (%v), want 1&23", text, err)
+	}
+}
+
+func TestCDSectNotReportedWithoutRawInput(t *testing.T) {
+	p := newParser(`<root><![CDATA[x]]></root>`)
+	advanceTo(t, p, "root")
+	tok, err := p.NextToken()
+	if err != nil || tok != xpp.Text || p.IsCDATA() {
+		t.Fatalf("NextToken = %v (%v) IsCDATA %v, want plain Text", tok, err, p.IsCDATA())
+	}
+}
+
+func TestExpectErrorContext(t *testing.T) {
+	doc := "<rss xmlns:a=\"urn:a\">\n  <a:channel>\n    <item>text <b/></item></a:channel></rss>"
+	p := xpp.NewReader(strings.NewReader(doc))
+	advanceTo(t, p, "item")
+
+	_, err := p.NextTag()
+	var ee *xpp.ExpectError
+	if !errors.As(err, &ee) {
+		t.Fatalf("NextTag = %v, want *ExpectError", err)
+	}
+	want := []xpp.Expected{{Event: xpp.StartTag, Space: "*", Name: "*"}, {Event: xpp.EndTag, Space: "*", Name: "*"}}
+	if len(ee.Expected) != 2 || ee.Expected[0] != want[0] || ee.Expected[1] != want[1] {
+		t.Fatalf("Expected = %+v, want StartTag or EndTag", ee.Expected)
+	}
+	if ee.Path != "/rss/a:channel/item" {
+		t.Fatalf("Path = %q", ee.Path)
+	}
+	if ee.Line != 3 || ee.Column != 16 {
+		t.Fatalf("position = %d:%d, want 3:16", ee.Line, ee.Column)
+	}
+	// The snippet ends with what the decoder has read.
+	if ee.Snippet != "    <item>text <" {
+		t.Fatalf("Snippet = %q", ee.Snippet)
+	}
+	if !errors.Is(err, xpp.ErrUnexpectedEvent) || errors.Is(err, xpp.ErrUnexpectedEOF) {
+		t.Fatalf("errors.Is mismatch for %v", err)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "StartTag or EndTag") || !strings.Contains(msg, "line 3, column 16") {
+		t.Fatalf("Error() = %q", msg)
+	}
+}
+
+func TestExpectErrorPathWithoutRawInput(t *testing.T) {
+	p := newParser(`<rss xmlns:a="urn:a"><a:channel>x</a:channel></rss>`)
+	advanceTo(t, p, "channel")
+	p.Next()
+	var ee *xpp.ExpectError
+	if err := p.Expect(xpp.EndTag, "item"); !errors.As(err, &ee) {
+		t.Fatalf("Expect = %v", err)
+	}
+	if ee.Path != "/rss/a:channel" || ee.Line != 1 || ee.Snippet != "" {
+		t.Fatalf("ExpectError = %+v", ee)
+	}
+}
+
+func TestSkipUnexpectedEOF(t *testing.T) {
+	p := xpp.NewReader(strings.NewReader(`<a><b>`), xpp.WithRecovery())
+	advanceTo(t, p, "a")
+	if err := p.Skip(); !errors.Is(err, xpp.ErrUnexpectedEOF) {
+		t.Fatalf("Skip = %v, want ErrUnexpectedEOF", err)
+	}
+}
+
+func TestQNameAndWrittenAttrs(t *testing.T) {
+	const doc = `<d:feed xmlns:d="urn:u" xmlns:e="urn:u" e:id='1' plain="a	b&#9;c
+d&#xA;e&amp;&lt;"/>`
+	p := xpp.NewReader(strings.NewReader(doc))
+	advanceTo(t, p, "feed")
+	if got := p.QName(); got != "d:feed" {
+		t.Errorf("QName = %q, want d:feed", got)
+	}
+	var got []string
+	for i := range p.Attrs() {
+		got = append(got, p.AttrQName(i)+"="+p.NormalizedAttr(i))
+	}
+	want := []string{"xmlns:d=urn:u", "xmlns:e=urn:u", "e:id=1", "plain=a b\tc d\ne&<"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("written attrs = %q, want %q", got, want)
+	}
+	if _, err := p.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if p.Event() != xpp.EndTag || p.QName() != "d:feed" {
+		t.Errorf("EndTag QName = %q", p.QName())
+	}
+
+	// Without the raw input, names are unknown and values as decoded.
+	p = newParser(doc)
+	advanceTo(t, p, "feed")
+	if p.QName() != "" || p.AttrQName(2) != "" || p.NormalizedAttr(3) != p.Attrs()[3].Value {
+		t.Errorf("New: QName %q, AttrQName %q, NormalizedAttr %q", p.QName(), p.AttrQName(2), p.NormalizedAttr(3))
+	}
+}
+
+func TestLangAndXMLSpace(t *testing.T) {
+	p := xpp.NewReader(strings.NewReader(`<a xml:lang="en"><b xml:space="default"><c xml:lang=""/></b></a>`))
+	want := []struct {
+		lang, space string
+		hasLang     bool
+		hasSpace    bool
+	}{
+		{"en", "", true, false},
+		{"en", "default", true, true},
+		{"", "default", true, true},
+	}
+	for _, w := range want {
+		if _, err := p.NextTag(); err != nil {
+			t.Fatal(err)
+		}
+		lang, hasLang := p.Lang()
+		space, hasSpace := p.XMLSpace()
+		if lang != w.lang || hasLang != w.hasLang || space != w.space || hasSpace != w.hasSpace {
+			t.Errorf("%s: Lang = %q %v, XMLSpace = %q %v", p.Name(), lang, hasLang, space, hasSpace)
+		}
+	}
+}